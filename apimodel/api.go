@@ -6,9 +6,8 @@ import (
 )
 
 const (
-	DefaultRepeatTimeSec     = int64(800)
-	DefaultPoolRepeatTimeSec = int64(3000)
-	IsDebugLogEnabled        = false
+	IsDebugLogEnabled = false
+	localLogAddress   = "localhost:514"
 )
 
 type GetNewFacesFeedResp struct {
@@ -27,6 +26,7 @@ type LMMFeedResp struct {
 	Matches            []commons.Profile `json:"matches"`
 	Messages           []commons.Profile `json:"messages"`
 	RepeatRequestAfter int64             `json:"repeatRequestAfter"`
+	SectionStatus      SectionStatus     `json:"sectionStatus,omitempty"`
 }
 
 func (resp LMMFeedResp) String() string {
@@ -40,12 +40,33 @@ type GetLcFeedResp struct {
 	AllMessagesProfilesNum int               `json:"allMessagesProfilesNum"`
 	LikesYou               []commons.Profile `json:"likesYou"`
 	Messages               []commons.Profile `json:"messages"`
+	//empty when there are no more profiles in the section or it is truncated
+	LikesYouNextCursor string `json:"likesYouNextCursor,omitempty"`
+	MessagesNextCursor string `json:"messagesNextCursor,omitempty"`
+	//true when the section has more profiles than can be paged through, the cursor is empty then
+	LikesYouTruncated bool `json:"likesYouTruncated,omitempty"`
+	MessagesTruncated bool `json:"messagesTruncated,omitempty"`
+	//the last good response served while internal functions are unavailable
+	Stale bool `json:"stale,omitempty"`
+}
+
+func (resp *GetLcFeedResp) MarkStale(repeatRequestAfter int64) {
+	resp.Stale = true
+	resp.RepeatRequestAfter = repeatRequestAfter
 }
 
 func (resp GetLcFeedResp) String() string {
 	return fmt.Sprintf("%#v", resp)
 }
 
+//GetLCRequest is commons.GetLCRequest with pagination, no cursor means the first page
+type GetLCRequest struct {
+	commons.GetLCRequest
+	LikesYouCursor *string `json:"likesYouCursor,omitempty"`
+	MessagesCursor *string `json:"messagesCursor,omitempty"`
+	PageSize       *int    `json:"pageSize,omitempty"`
+}
+
 type LMHISFeedResp struct {
 	commons.BaseResponse
 	LikesYou           []commons.Profile `json:"likesYou"`
@@ -54,6 +75,14 @@ type LMHISFeedResp struct {
 	Inbox              []commons.Profile `json:"inbox"`
 	Sent               []commons.Profile `json:"sent"`
 	RepeatRequestAfter int64             `json:"repeatRequestAfter"`
+	SectionStatus      SectionStatus     `json:"sectionStatus,omitempty"`
+	//the last good response served while internal functions are unavailable
+	Stale bool `json:"stale,omitempty"`
+}
+
+func (resp *LMHISFeedResp) MarkStale(repeatRequestAfter int64) {
+	resp.Stale = true
+	resp.RepeatRequestAfter = repeatRequestAfter
 }
 
 func (resp LMHISFeedResp) String() string {
@@ -0,0 +1,114 @@
+package apimodel
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//AuthCache keeps user ids of verified access tokens in memory of the warm container,
+//tokens are stored only as hashes, the least recently used entry is evicted when cache is full
+type AuthCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type authCacheEntry struct {
+	key       string
+	userId    string
+	expiresAt time.Time
+}
+
+func NewAuthCache(ttl time.Duration, maxSize int) *AuthCache {
+	return &AuthCache{ttl: ttl, maxSize: maxSize, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+//app version and platform are part of the key, because auth checks them as well
+func authCacheKey(appVersion int, isItAndroid bool, accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken + ":" + strconv.Itoa(appVersion) + ":" + strconv.FormatBool(isItAndroid)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *AuthCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*authCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return entry.userId, true
+}
+
+func (c *AuthCache) Put(key, userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.order.Len() >= c.maxSize && c.order.Len() != 0 {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&authCacheEntry{key: key, userId: userId, expiresAt: time.Now().Add(c.ttl)})
+}
+
+func (c *AuthCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *AuthCache) remove(element *list.Element) {
+	entry := element.Value.(*authCacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+}
+
+//AuthCachingFeedsBackend answers VerifyAccessToken from the cache, other calls go directly to the next backend.
+//Only successful verifications are cached. Auth is not asked about a cached token and internal functions
+//don't check tokens, so cached tokens expire by ttl only, a token revoked by auth stays valid here until then.
+type AuthCachingFeedsBackend struct {
+	FeedsBackend
+	cache *AuthCache
+}
+
+func NewAuthCachingFeedsBackend(next FeedsBackend, cache *AuthCache) *AuthCachingFeedsBackend {
+	return &AuthCachingFeedsBackend{FeedsBackend: next, cache: cache}
+}
+
+func (b *AuthCachingFeedsBackend) VerifyAccessToken(ctx context.Context, appVersion int, isItAndroid bool, accessToken string, lc *lambdacontext.LambdaContext) (string, bool, string) {
+	key := authCacheKey(appVersion, isItAndroid, accessToken)
+	if userId, ok := b.cache.Get(key); ok {
+		Anlogger.Debugf(lc, "auth_cache.go : access token of userId [%s] was found in the cache", userId)
+		return userId, true, ""
+	}
+
+	userId, ok, errStr := b.FeedsBackend.VerifyAccessToken(ctx, appVersion, isItAndroid, accessToken, lc)
+	if !ok {
+		return userId, ok, errStr
+	}
+	b.cache.Put(key, userId)
+	return userId, true, ""
+}
+
+//withAuthCache wraps backend with auth cache if it is enabled by AUTH_CACHE_TTL_SEC
+func withAuthCache(backend FeedsBackend, config Config) FeedsBackend {
+	if config.AuthCacheTTLSec <= 0 {
+		return backend
+	}
+	return NewAuthCachingFeedsBackend(backend, NewAuthCache(time.Duration(config.AuthCacheTTLSec)*time.Second, config.AuthCacheMaxSize))
+}
@@ -0,0 +1,25 @@
+package apimodel
+
+import (
+	"context"
+	"github.com/ringoid/commons"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+//FeedsBackend is everything feeds need from internal functions. Each call returns response, ok and error string.
+//Internal calls are aborted when ctx is done.
+type FeedsBackend interface {
+	//userId, ok and error string
+	VerifyAccessToken(ctx context.Context, appVersion int, isItAndroid bool, accessToken string, lc *lambdacontext.LambdaContext) (string, bool, string)
+	GetNewFaces(ctx context.Context, req commons.InternalGetNewFacesReq, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string)
+	Discover(ctx context.Context, req *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string)
+	GetLC(ctx context.Context, functionName string, req *commons.GetLCRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetLCResp, bool, string)
+	LMM(ctx context.Context, functionName string, req commons.InternalLMMReq, lc *lambdacontext.LambdaContext) (commons.InternalLMMResp, bool, string)
+	LMHIS(ctx context.Context, functionName string, req commons.InternalLMHISReq, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string)
+	Chat(ctx context.Context, req commons.InternalChatRequest, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, bool, string)
+	//fire and forget, so there is no response
+	PrepareNewFaces(ctx context.Context, req commons.InternalPrepareNewFacesReq, lc *lambdacontext.LambdaContext) (bool, string)
+}
+
+//Backend is initialized in InitLambdaVars, replace it with FakeFeedsBackend to run without AWS
+var Backend FeedsBackend
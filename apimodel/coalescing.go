@@ -0,0 +1,165 @@
+package apimodel
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CoalesceKey identifies requests with the same response, Filter contains the rest of params which change the response
+type CoalesceKey struct {
+	Endpoint       string
+	UserId         string
+	LastActionTime int64
+	Resolution     string
+	Filter         string
+}
+
+func (k CoalesceKey) String() string {
+	return fmt.Sprintf("%s|%s|%d|%s|%s", k.Endpoint, k.UserId, k.LastActionTime, k.Resolution, k.Filter)
+}
+
+//CoalesceFilter joins params into CoalesceKey.Filter
+func CoalesceFilter(params ...interface{}) string {
+	values := make([]string, 0, len(params))
+	for _, each := range params {
+		values = append(values, fmt.Sprint(each))
+	}
+	return strings.Join(values, ",")
+}
+
+//Coalescer lets identical concurrent requests of the warm container share one backend fan-out (singleflight)
+//and, if cache ttl is set, returns remembered responses of identical requests which came a bit later.
+//Lambda container serves one request at a time, so there duplicates are mostly served by the cache.
+//Shared responses are read only.
+type Coalescer struct {
+	enabled  bool
+	cacheTTL time.Duration
+	maxSize  int
+	//time.Now, tests replace it
+	clock func() time.Time
+
+	mu     sync.Mutex
+	calls  map[string]*coalescedCall
+	cached map[string]cachedResponse
+}
+
+type coalescedCall struct {
+	done   chan struct{}
+	value  interface{}
+	ok     bool
+	errStr string
+	//number of identical requests which wait for the call, guarded by Coalescer.mu
+	waiters int
+}
+
+type cachedResponse struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+//Coalescing is disabled until InitCoalescing
+var Coalescing = &Coalescer{}
+
+func NewCoalescer(cacheTTL time.Duration, maxSize int) *Coalescer {
+	return &Coalescer{
+		enabled:  true,
+		cacheTTL: cacheTTL,
+		maxSize:  maxSize,
+		clock:    time.Now,
+		calls:    make(map[string]*coalescedCall),
+		cached:   make(map[string]cachedResponse),
+	}
+}
+
+func InitCoalescing(config Config) {
+	if !config.CoalesceEnabled {
+		Coalescing = &Coalescer{}
+		return
+	}
+	Coalescing = NewCoalescer(time.Duration(config.CoalesceCacheTTLMs)*time.Millisecond, config.CoalesceCacheMaxSize)
+}
+
+//Do returns remembered response, waits for identical in-flight request or calls fn itself.
+//The last value is true only if this call ran fn, only such responses should be remembered,
+//otherwise every repeated request would extend the ttl of the same response.
+func (c *Coalescer) Do(ctx context.Context, key CoalesceKey, fn func(ctx context.Context) (interface{}, bool, string),
+	lc *lambdacontext.LambdaContext) (interface{}, bool, string, bool) {
+	if !c.enabled {
+		value, ok, errStr := fn(ctx)
+		return value, ok, errStr, true
+	}
+
+	k := key.String()
+	c.mu.Lock()
+	if cached, ok := c.cached[k]; ok && c.clock().Before(cached.expiresAt) {
+		c.mu.Unlock()
+		Anlogger.Debugf(lc, "coalescing.go : return remembered [%s] response for userId [%s]", key.Endpoint, key.UserId)
+		return cached.value, true, "", false
+	}
+	if call, ok := c.calls[k]; ok {
+		call.waiters++
+		c.mu.Unlock()
+		Anlogger.Debugf(lc, "coalescing.go : wait for identical in-flight [%s] request of userId [%s]", key.Endpoint, key.UserId)
+		select {
+		case <-call.done:
+			return call.value, call.ok, call.errStr, false
+		case <-ctx.Done():
+			return nil, false, internalCallErrorStr(ctx), false
+		}
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[k] = call
+	c.mu.Unlock()
+
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			//waiters return an error to the client instead of empty response
+			call.value, call.ok, call.errStr = nil, false, commons.InternalServerError
+		}
+		c.mu.Lock()
+		delete(c.calls, k)
+		waiters := call.waiters
+		c.mu.Unlock()
+		close(call.done)
+		if waiters != 0 {
+			Anlogger.Debugf(lc, "coalescing.go : [%s] response of userId [%s] was shared with [%d] identical requests", key.Endpoint, key.UserId, waiters)
+		}
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+	call.value, call.ok, call.errStr = fn(ctx)
+	return call.value, call.ok, call.errStr, true
+}
+
+//Remember keeps complete response for cache ttl, responses with repeat hint or failed sections should not be remembered.
+//Pass only fresh responses from Do, a remembered one stays until its first ttl ends.
+func (c *Coalescer) Remember(key CoalesceKey, value interface{}) {
+	if !c.enabled || c.cacheTTL <= 0 {
+		return
+	}
+	now := c.clock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cached) >= c.maxSize {
+		for k, each := range c.cached {
+			if now.After(each.expiresAt) {
+				delete(c.cached, k)
+			}
+		}
+	}
+	//all entries are fresh, drop any
+	for k := range c.cached {
+		if len(c.cached) < c.maxSize {
+			break
+		}
+		delete(c.cached, k)
+	}
+	c.cached[key.String()] = cachedResponse{value: value, expiresAt: now.Add(c.cacheTTL)}
+}
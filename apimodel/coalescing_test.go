@@ -0,0 +1,184 @@
+package apimodel
+
+import (
+	"context"
+	"github.com/ringoid/commons"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//testClock is moved by tests, so ttl doesn't depend on how fast the test runs
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+//waitForWaiters returns when num identical requests wait for the in-flight call of the key
+func waitForWaiters(t *testing.T, c *Coalescer, key CoalesceKey, num int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		call, ok := c.calls[key.String()]
+		waiters := 0
+		if ok {
+			waiters = call.waiters
+		}
+		c.mu.Unlock()
+		if waiters == num {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d requests did not start to wait for the call", num)
+}
+
+func TestCoalescerCacheHitDoesNotExtendTTL(t *testing.T) {
+	const ttl = time.Minute
+	clock := &testClock{now: time.Now()}
+	c := NewCoalescer(ttl, 10)
+	c.clock = clock.Now
+	key := CoalesceKey{Endpoint: "lmm", UserId: "u"}
+	calls := 0
+	//the same as handlers do, only fresh responses are remembered
+	serve := func() (interface{}, bool) {
+		value, ok, errStr, fresh := c.Do(context.Background(), key, func(ctx context.Context) (interface{}, bool, string) {
+			calls++
+			return calls, true, ""
+		}, nil)
+		if !ok {
+			t.Fatalf("unexpected error %s", errStr)
+		}
+		if fresh {
+			c.Remember(key, value)
+		}
+		return value, fresh
+	}
+
+	if value, fresh := serve(); value != 1 || !fresh {
+		t.Fatalf("first call got (%v, %v), want (1, true)", value, fresh)
+	}
+	clock.Add(ttl / 2)
+	if value, fresh := serve(); value != 1 || fresh {
+		t.Fatalf("call within ttl got (%v, %v), want remembered (1, false)", value, fresh)
+	}
+	//more than ttl after the first call but less than ttl after the hit
+	clock.Add(ttl/2 + time.Second)
+	if value, fresh := serve(); value != 2 || !fresh {
+		t.Fatalf("call after ttl got (%v, %v), want (2, true)", value, fresh)
+	}
+}
+
+func TestCoalescerSharesInFlightCall(t *testing.T) {
+	c := NewCoalescer(0, 10)
+	key := CoalesceKey{Endpoint: "get_lc", UserId: "u"}
+	var calls int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, bool, string) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		return "feed", true, ""
+	}
+
+	const num = 5
+	var wg sync.WaitGroup
+	var freshNum int32
+	do := func() {
+		defer wg.Done()
+		value, ok, _, fresh := c.Do(context.Background(), key, fn, nil)
+		if !ok || value != "feed" {
+			t.Errorf("got (%v, %v), want (feed, true)", value, ok)
+		}
+		if fresh {
+			atomic.AddInt32(&freshNum, 1)
+		}
+	}
+	wg.Add(num)
+	go do()
+	<-started
+	for i := 1; i < num; i++ {
+		go do()
+	}
+	waitForWaiters(t, c, key, num-1)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	if freshNum != 1 {
+		t.Errorf("%d calls reported fresh response, want 1", freshNum)
+	}
+}
+
+func TestCoalescerPanicReturnsErrorToWaiters(t *testing.T) {
+	c := NewCoalescer(0, 10)
+	key := CoalesceKey{Endpoint: "lmhis", UserId: "u"}
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			panicked <- recover()
+		}()
+		c.Do(context.Background(), key, func(ctx context.Context) (interface{}, bool, string) {
+			close(started)
+			<-release
+			panic("mapping failed")
+		}, nil)
+	}()
+	<-started
+
+	type result struct {
+		ok     bool
+		errStr string
+	}
+	results := make(chan result, 1)
+	go func() {
+		_, ok, errStr, _ := c.Do(context.Background(), key, func(ctx context.Context) (interface{}, bool, string) {
+			return "feed", true, ""
+		}, nil)
+		results <- result{ok: ok, errStr: errStr}
+	}()
+	waitForWaiters(t, c, key, 1)
+	close(release)
+
+	if recovered := <-panicked; recovered != "mapping failed" {
+		t.Errorf("caller recovered [%v], want the panic of fn", recovered)
+	}
+	if got := <-results; got.ok || got.errStr != commons.InternalServerError {
+		t.Errorf("waiter got (%v, %s), want (false, %s)", got.ok, got.errStr, commons.InternalServerError)
+	}
+}
+
+func TestCoalescerDisabledAlwaysCalls(t *testing.T) {
+	c := &Coalescer{}
+	key := CoalesceKey{Endpoint: "lmhis", UserId: "u"}
+	calls := 0
+	for i := 0; i < 2; i++ {
+		_, _, _, fresh := c.Do(context.Background(), key, func(ctx context.Context) (interface{}, bool, string) {
+			calls++
+			return calls, true, ""
+		}, nil)
+		c.Remember(key, calls)
+		if !fresh {
+			t.Errorf("call %d not fresh", i)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
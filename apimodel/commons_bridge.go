@@ -0,0 +1,156 @@
+package apimodel
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//syslog messages of commons logger are short, papertrail limits them to 1KB as well
+	commonsBridgeBufferSize = 64 * 1024
+	//packet which the bridge sends to itself to find out that everything sent before it was written
+	commonsBridgeDrainMarker = "\x00commons-bridge-drain:"
+	//the same as metrics, the handler doesn't wait for logs longer
+	commonsBridgeDrainTimeout = 200 * time.Millisecond
+)
+
+//CommonsBridge receives syslog messages which commons.Logger sends over udp and writes them to the next logger,
+//so commons functions log to the same backend as the service and through the same redaction.
+//Messages are delivered asynchronously, call Drain before the container can be frozen.
+type CommonsBridge struct {
+	conn net.PacketConn
+	tag  string
+	next Logger
+
+	mu       sync.Mutex
+	drainSeq uint64
+	drains   map[string]chan struct{}
+}
+
+//NewCommonsBridge listens on a random local udp port, tag is the app name which commons.Logger puts into messages
+func NewCommonsBridge(tag string, next Logger) (*CommonsBridge, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error listening commons logger messages : %v", err)
+	}
+	bridge := &CommonsBridge{conn: conn, tag: tag, next: next, drains: make(map[string]chan struct{})}
+	go bridge.serve()
+	return bridge, nil
+}
+
+//Address to pass to commons.New
+func (b *CommonsBridge) Address() string {
+	return b.conn.LocalAddr().String()
+}
+
+func (b *CommonsBridge) Close() error {
+	return b.conn.Close()
+}
+
+//Drain waits until messages sent before the call are written, false if it took longer than timeout.
+//Loopback udp puts the packet into the socket queue before send returns, so the marker sent here is read
+//after all of them.
+func (b *CommonsBridge) Drain(timeout time.Duration) bool {
+	b.mu.Lock()
+	b.drainSeq++
+	marker := commonsBridgeDrainMarker + strconv.FormatUint(b.drainSeq, 10)
+	done := make(chan struct{})
+	b.drains[marker] = done
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.drains, marker)
+		b.mu.Unlock()
+	}()
+
+	if _, err := b.conn.WriteTo([]byte(marker), b.conn.LocalAddr()); err != nil {
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (b *CommonsBridge) serve() {
+	buf := make([]byte, commonsBridgeBufferSize)
+	for {
+		n, _, err := b.conn.ReadFrom(buf)
+		if err != nil {
+			//closed
+			return
+		}
+		packet := string(buf[:n])
+		if strings.HasPrefix(packet, commonsBridgeDrainMarker) {
+			b.drained(packet)
+			continue
+		}
+		level, message := b.parse(packet)
+		//next logger redacts only arguments which are json as a whole
+		b.write(level, RedactText(message))
+	}
+}
+
+func (b *CommonsBridge) drained(marker string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if done, ok := b.drains[marker]; ok {
+		close(done)
+		delete(b.drains, marker)
+	}
+}
+
+//parse returns level and message of "<priority>timestamp host tag[pid]: message", level is info
+//when there is no priority
+func (b *CommonsBridge) parse(packet string) (string, string) {
+	packet = strings.TrimRight(packet, "\r\n")
+	level := levelInfo
+	if strings.HasPrefix(packet, "<") {
+		if end := strings.Index(packet, ">"); end > 0 {
+			if priority, err := strconv.Atoi(packet[1:end]); err == nil {
+				level = syslogLevel(priority % 8)
+			}
+			packet = packet[end+1:]
+		}
+	}
+	if start := strings.Index(packet, b.tag); start >= 0 {
+		if colon := strings.Index(packet[start:], ": "); colon >= 0 {
+			packet = packet[start+colon+2:]
+		}
+	}
+	return level, packet
+}
+
+func syslogLevel(severity int) string {
+	switch {
+	case severity <= 2:
+		return levelFatal
+	case severity == 3:
+		return levelError
+	case severity == 4:
+		return levelWarn
+	case severity == 7:
+		return levelDebug
+	}
+	return levelInfo
+}
+
+func (b *CommonsBridge) write(level, message string) {
+	//commons logger stops the process after fatal by itself
+	switch level {
+	case levelDebug:
+		b.next.Debugf(nil, "%s", message)
+	case levelWarn:
+		b.next.Warnf(nil, "%s", message)
+	case levelError, levelFatal:
+		b.next.Errorf(nil, "%s", message)
+	default:
+		b.next.Infof(nil, "%s", message)
+	}
+}
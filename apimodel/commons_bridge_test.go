@@ -0,0 +1,48 @@
+package apimodel
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommonsBridgeDrain(t *testing.T) {
+	var buf bytes.Buffer
+	bridge, err := NewCommonsBridge("test-feeds", NewRedactingLogger(NewJSONLogger(&buf, "test")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Close()
+
+	conn, err := net.Dial("udp", bridge.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	unmask := MaskSecret("tok-123")
+	defer unmask()
+	for _, each := range []string{
+		"<14>Oct 18 12:00:00 host test-feeds[1]: first message",
+		`<11>Oct 18 12:00:00 host test-feeds[1]: verify token [tok-123] with {"accessToken":"tok-123"}`,
+	} {
+		if _, err := conn.Write([]byte(each)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bridge.Drain(time.Second) {
+		t.Fatalf("bridge was not drained")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2 : %s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], `"message":"first message"`) || !strings.Contains(lines[0], `"level":"info"`) {
+		t.Errorf("unexpected first record %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"level":"error"`) || strings.Contains(lines[1], "tok-123") {
+		t.Errorf("unexpected second record %s", lines[1])
+	}
+}
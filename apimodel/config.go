@@ -0,0 +1,371 @@
+package apimodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//file with overrides, json object with the same keys as env variables
+const ConfigFileEnv = "CONFIG_FILE"
+
+//Config is everything service needs from the environment, env tag is the name of the variable,
+//required fields must be set by file or env, default is used when nothing is set
+type Config struct {
+	Env string `env:"ENV" required:"true"`
+	//papertrail or json, json is written to LOG_FILE or stdout
+	LogBackend           string `env:"LOG_BACKEND" default:"papertrail"`
+	LogFile              string `env:"LOG_FILE"`
+	PapertrailLogAddress string `env:"PAPERTRAIL_LOG_ADDRESS"`
+
+	InternalAuthFunctionName    string `env:"INTERNAL_AUTH_FUNCTION_NAME" required:"true"`
+	GetNewFacesFunctionName     string `env:"INTERNAL_GET_NEW_FACES_FUNCTION_NAME" required:"true"`
+	DiscoverFunctionName        string `env:"INTERNAL_DISCOVER_FUNCTION_NAME" required:"true"`
+	GetLcLikesFunctionName      string `env:"INTERNAL_GET_LC_LIKES_FUNCTION_NAME" required:"true"`
+	GetLcMessagesFunctionName   string `env:"INTERNAL_GET_LC_MSG_FUNCTION_NAME" required:"true"`
+	LikesYouFunctionName        string `env:"INTERNAL_LIKES_YOU_FUNCTION_NAME" required:"true"`
+	MatchesFunctionName         string `env:"INTERNAL_MATCHES_FUNCTION_NAME" required:"true"`
+	MessagesFunctionName        string `env:"INTERNAL_MESSAGES_FUNCTION_NAME" required:"true"`
+	LMHISFunctionName           string `env:"INTERNAL_LMHIS_FUNCTION_NAME" required:"true"`
+	ChatFunctionName            string `env:"INTERNAL_CHAT_FUNCTION_NAME" required:"true"`
+	PrepareNewFacesFunctionName string `env:"INTERNAL_PREPARE_NF_FUNCTION_NAME" required:"true"`
+
+	CommonStreamName   string `env:"COMMON_STREAM" required:"true"`
+	DeliveryStreamName string `env:"DELIVERY_STREAM" required:"true"`
+
+	BaseCloudWatchNamespace          string `env:"BASE_CLOUD_WATCH_NAMESPACE" required:"true"`
+	NewFaceProfilesReturnMetricName  string `env:"CLOUD_WATCH_NEW_FACES_RETURN" required:"true"`
+	LikesYouProfilesReturnMetricName string `env:"CLOUD_WATCH_LIKES_YOU_RETURN" required:"true"`
+	MatchProfilesReturnMetricName    string `env:"CLOUD_WATCH_MATCHES_RETURN" required:"true"`
+	MessageProfilesReturnMetricName  string `env:"CLOUD_WATCH_MESSAGES_RETURN" required:"true"`
+
+	CloudFrontDomain string `env:"CLOUDFRONT_DISTRIBUTION_DOMAIN" required:"true"`
+	UseCloudFront    bool   `env:"USE_CLOUDFRONT" required:"true"`
+
+	LocationPrivacyMode         string  `env:"LOCATION_PRIVACY_MODE" default:"grid"`
+	LocationPrivacyGridMeters   float64 `env:"LOCATION_PRIVACY_GRID_METERS" default:"1000"`
+	LocationPrivacyJitterMeters float64 `env:"LOCATION_PRIVACY_JITTER_METERS" default:"1000"`
+	LocationPrivacySalt         string  `env:"LOCATION_PRIVACY_SALT" secret:"true"`
+
+	//flags document is read from s3 if bucket is set, from the file otherwise
+	FeatureFlagsFile       string `env:"FEATURE_FLAGS_FILE"`
+	FeatureFlagsBucket     string `env:"FEATURE_FLAGS_S3_BUCKET"`
+	FeatureFlagsKey        string `env:"FEATURE_FLAGS_S3_KEY"`
+	FeatureFlagsRefreshSec int    `env:"FEATURE_FLAGS_REFRESH_SEC" default:"60"`
+
+	//otlp exporter reads endpoint and headers from standard OTEL_EXPORTER_OTLP_* env
+	TracingExporter string `env:"TRACING_EXPORTER" default:"none"`
+	TracingFile     string `env:"TRACING_FILE"`
+
+	MetricsBackend string `env:"METRICS_BACKEND" default:"emf"`
+
+	//token revoked by auth is still accepted by warm containers for up to this time, 0 disables the cache
+	AuthCacheTTLSec  int `env:"AUTH_CACHE_TTL_SEC" default:"5"`
+	AuthCacheMaxSize int `env:"AUTH_CACHE_MAX_SIZE" default:"10000"`
+
+	RateLimitEnabled bool `env:"RATE_LIMIT_ENABLED" default:"true"`
+	//json object endpoint -> limits which override defaults, e.g. {"chat":{"perUser":{"perMinute":60,"burst":10}}}
+	RateLimits string `env:"RATE_LIMITS"`
+
+	CoalesceEnabled bool `env:"COALESCE_ENABLED" default:"true"`
+	//lambda container serves one request at a time, so only the cache catches duplicates there, 0 disables it
+	CoalesceCacheTTLMs   int `env:"COALESCE_CACHE_TTL_MS" default:"1000"`
+	CoalesceCacheMaxSize int `env:"COALESCE_CACHE_MAX_SIZE" default:"1000"`
+
+	FallbackEnabled bool `env:"FALLBACK_ENABLED" default:"true"`
+	FallbackMaxSize int  `env:"FALLBACK_MAX_SIZE" default:"1000"`
+	//older responses are not served and are deleted, they contain personal data
+	FallbackMaxAgeSec int `env:"FALLBACK_MAX_AGE_SEC" default:"3600"`
+	//empty keeps the last good responses only in container memory
+	FallbackDir string `env:"FALLBACK_DIR"`
+
+	ResilienceEnabled bool `env:"RESILIENCE_ENABLED" default:"true"`
+	//attempts include the first call, only throttled calls and timed out functions are retried
+	RetryMaxAttempts int `env:"RETRY_MAX_ATTEMPTS" default:"3"`
+	RetryBaseDelayMs int `env:"RETRY_BASE_DELAY_MS" default:"50"`
+	RetryMaxDelayMs  int `env:"RETRY_MAX_DELAY_MS" default:"1000"`
+	//failed calls in a row which open the circuit and how long it stays open
+	CircuitFailureThreshold int `env:"CIRCUIT_FAILURE_THRESHOLD" default:"5"`
+	CircuitOpenSec          int `env:"CIRCUIT_OPEN_SEC" default:"10"`
+
+	//duplicate get_lc and lmhis section calls which are slower than p95 of the section
+	HedgeEnabled bool `env:"HEDGE_ENABLED" default:"false"`
+	//hedges are at most this percent of section calls
+	HedgeBudgetPercent int `env:"HEDGE_BUDGET_PERCENT" default:"5"`
+	HedgeMinDelayMs    int `env:"HEDGE_MIN_DELAY_MS" default:"50"`
+	//successful calls of the section before it is hedged
+	HedgeMinSamples int `env:"HEDGE_MIN_SAMPLES" default:"20"`
+
+	//bounds of repeatRequestAfter which is a half of lastActionTime lag
+	PollingMinRepeatRequestAfterMs int64 `env:"POLLING_MIN_REPEAT_REQUEST_AFTER_MS" default:"300"`
+	PollingMaxRepeatRequestAfterMs int64 `env:"POLLING_MAX_REPEAT_REQUEST_AFTER_MS" default:"5000"`
+	//pullAgainAfter of active and idle chats
+	PollingMinPullAgainAfterMs int64 `env:"POLLING_MIN_PULL_AGAIN_AFTER_MS" default:"1000"`
+	PollingMaxPullAgainAfterMs int64 `env:"POLLING_MAX_PULL_AGAIN_AFTER_MS" default:"15000"`
+	PollingActiveChatSec       int   `env:"POLLING_ACTIVE_CHAT_SEC" default:"120"`
+	PollingIdleChatSec         int   `env:"POLLING_IDLE_CHAT_SEC" default:"3600"`
+	//average latency of internal calls which doubles both hints
+	PollingSlowLatencyMs int `env:"POLLING_SLOW_LATENCY_MS" default:"1000"`
+}
+
+//ConfigError contains all problems found during loading
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("wrong config : %s", strings.Join(e.Problems, "; "))
+}
+
+//LoadConfig reads config for the lambda from CONFIG_FILE and env, env wins
+func LoadConfig() (Config, error) {
+	return loadConfig(Config{}, true)
+}
+
+//LoadLocalConfig is LoadConfig with local placeholders instead of required values,
+//fake backend keys use these function names
+func LoadLocalConfig() (Config, error) {
+	return loadConfig(Config{
+		Env:                         "local",
+		LogBackend:                  LogBackendJSON,
+		MetricsBackend:              MetricsBackendNone,
+		PapertrailLogAddress:        localLogAddress,
+		InternalAuthFunctionName:    "auth",
+		GetNewFacesFunctionName:     "get-new-faces",
+		DiscoverFunctionName:        "discover",
+		GetLcLikesFunctionName:      "get-lc-likes",
+		GetLcMessagesFunctionName:   "get-lc-messages",
+		LikesYouFunctionName:        "likes-you",
+		MatchesFunctionName:         "matches",
+		MessagesFunctionName:        "messages",
+		LMHISFunctionName:           "lmhis",
+		ChatFunctionName:            "chat",
+		PrepareNewFacesFunctionName: "prepare-new-faces",
+
+		BaseCloudWatchNamespace:          "local-feeds-service",
+		NewFaceProfilesReturnMetricName:  "NewFaceProfilesReturn",
+		LikesYouProfilesReturnMetricName: "LikesYouProfilesReturn",
+		MatchProfilesReturnMetricName:    "MatchProfilesReturn",
+		MessageProfilesReturnMetricName:  "MessageProfilesReturn",
+	}, false)
+}
+
+func loadConfig(config Config, checkRequired bool) (Config, error) {
+	problems := make([]string, 0)
+
+	values := make(map[string]string)
+	if fileName, ok := os.LookupEnv(ConfigFileEnv); ok {
+		fileValues, err := readConfigFile(fileName)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	value := reflect.ValueOf(&config).Elem()
+	configType := value.Type()
+	known := make(map[string]bool)
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name := field.Tag.Get("env")
+		known[name] = true
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			raw, ok = values[name]
+		}
+		if !ok {
+			raw, ok = field.Tag.Lookup("default")
+			//placeholder from the base config is better than the default
+			if ok && !value.Field(i).IsZero() {
+				continue
+			}
+		}
+		if !ok {
+			if checkRequired && field.Tag.Get("required") == "true" {
+				problems = append(problems, fmt.Sprintf("%s can not be empty", name))
+			}
+			continue
+		}
+		err := setConfigField(value.Field(i), raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has wrong value [%s] : %v", name, raw, err))
+		}
+	}
+
+	for key := range values {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("%s contains unknown key %s", ConfigFileEnv, key))
+		}
+	}
+
+	problems = append(problems, config.validate()...)
+	if len(problems) != 0 {
+		return config, &ConfigError{Problems: problems}
+	}
+	return config, nil
+}
+
+func readConfigFile(fileName string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s [%s] : %v", ConfigFileEnv, fileName, err)
+	}
+	//strings are taken as they are, the rest is kept as json text, e.g. 1000000 instead of 1e+06
+	//and RATE_LIMITS object as json which its parser expects
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s [%s] : %v", ConfigFileEnv, fileName, err)
+	}
+	values := make(map[string]string)
+	for key, value := range raw {
+		var str string
+		if json.Unmarshal(value, &str) == nil {
+			values[key] = str
+			continue
+		}
+		values[key] = string(bytes.TrimSpace(value))
+	}
+	return values, nil
+}
+
+func setConfigField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+func (c Config) validate() []string {
+	problems := make([]string, 0)
+	if c.LogBackend != LogBackendPapertrail && c.LogBackend != LogBackendJSON {
+		problems = append(problems, fmt.Sprintf("LOG_BACKEND has unsupported value [%s]", c.LogBackend))
+	}
+	if c.LogBackend == LogBackendPapertrail && len(c.PapertrailLogAddress) == 0 {
+		problems = append(problems, "PAPERTRAIL_LOG_ADDRESS can not be empty when LOG_BACKEND is papertrail")
+	}
+	if c.LocationPrivacyMode != LocationPrivacyNone && c.LocationPrivacyMode != LocationPrivacyGrid && c.LocationPrivacyMode != LocationPrivacyJitter {
+		problems = append(problems, fmt.Sprintf("LOCATION_PRIVACY_MODE has unsupported value [%s]", c.LocationPrivacyMode))
+	}
+	if c.LocationPrivacyGridMeters <= 0 {
+		problems = append(problems, "LOCATION_PRIVACY_GRID_METERS should be positive")
+	}
+	if c.LocationPrivacyJitterMeters <= 0 {
+		problems = append(problems, "LOCATION_PRIVACY_JITTER_METERS should be positive")
+	}
+	//without salt noise can be recalculated by anyone who knows both userIds
+	if c.LocationPrivacyMode == LocationPrivacyJitter && len(c.LocationPrivacySalt) == 0 {
+		problems = append(problems, "LOCATION_PRIVACY_SALT can not be empty when LOCATION_PRIVACY_MODE is jitter")
+	}
+	if len(c.FeatureFlagsBucket) != 0 && len(c.FeatureFlagsKey) == 0 {
+		problems = append(problems, "FEATURE_FLAGS_S3_KEY can not be empty when FEATURE_FLAGS_S3_BUCKET is set")
+	}
+	if c.FeatureFlagsRefreshSec < 0 {
+		problems = append(problems, "FEATURE_FLAGS_REFRESH_SEC can not be negative")
+	}
+	if c.TracingExporter != TracingExporterNone && c.TracingExporter != TracingExporterOTLP && c.TracingExporter != TracingExporterFile {
+		problems = append(problems, fmt.Sprintf("TRACING_EXPORTER has unsupported value [%s]", c.TracingExporter))
+	}
+	if c.MetricsBackend != MetricsBackendNone && c.MetricsBackend != MetricsBackendEMF {
+		problems = append(problems, fmt.Sprintf("METRICS_BACKEND has unsupported value [%s]", c.MetricsBackend))
+	}
+	if c.AuthCacheTTLSec < 0 {
+		problems = append(problems, "AUTH_CACHE_TTL_SEC can not be negative")
+	}
+	if c.AuthCacheMaxSize <= 0 {
+		problems = append(problems, "AUTH_CACHE_MAX_SIZE should be positive")
+	}
+	if _, err := parseRateLimits(c.RateLimits); err != nil {
+		problems = append(problems, fmt.Sprintf("RATE_LIMITS has wrong value : %v", err))
+	}
+	if c.CoalesceCacheTTLMs < 0 {
+		problems = append(problems, "COALESCE_CACHE_TTL_MS can not be negative")
+	}
+	if c.CoalesceCacheMaxSize <= 0 {
+		problems = append(problems, "COALESCE_CACHE_MAX_SIZE should be positive")
+	}
+	if c.FallbackMaxSize <= 0 {
+		problems = append(problems, "FALLBACK_MAX_SIZE should be positive")
+	}
+	if c.FallbackMaxAgeSec <= 0 {
+		problems = append(problems, "FALLBACK_MAX_AGE_SEC should be positive")
+	}
+	if c.RetryMaxAttempts <= 0 {
+		problems = append(problems, "RETRY_MAX_ATTEMPTS should be positive")
+	}
+	if c.RetryBaseDelayMs < 0 || c.RetryMaxDelayMs < c.RetryBaseDelayMs {
+		problems = append(problems, "RETRY_BASE_DELAY_MS can not be negative or greater than RETRY_MAX_DELAY_MS")
+	}
+	if c.CircuitFailureThreshold <= 0 {
+		problems = append(problems, "CIRCUIT_FAILURE_THRESHOLD should be positive")
+	}
+	if c.CircuitOpenSec <= 0 {
+		problems = append(problems, "CIRCUIT_OPEN_SEC should be positive")
+	}
+	if c.HedgeBudgetPercent < 0 || c.HedgeBudgetPercent > 100 {
+		problems = append(problems, "HEDGE_BUDGET_PERCENT should be between 0 and 100")
+	}
+	if c.HedgeMinDelayMs < 0 {
+		problems = append(problems, "HEDGE_MIN_DELAY_MS can not be negative")
+	}
+	if c.HedgeMinSamples <= 0 {
+		problems = append(problems, "HEDGE_MIN_SAMPLES should be positive")
+	}
+	if c.PollingMinRepeatRequestAfterMs <= 0 || c.PollingMaxRepeatRequestAfterMs < c.PollingMinRepeatRequestAfterMs {
+		problems = append(problems, "POLLING_MIN_REPEAT_REQUEST_AFTER_MS should be positive and not greater than POLLING_MAX_REPEAT_REQUEST_AFTER_MS")
+	}
+	if c.PollingMinPullAgainAfterMs <= 0 || c.PollingMaxPullAgainAfterMs < c.PollingMinPullAgainAfterMs {
+		problems = append(problems, "POLLING_MIN_PULL_AGAIN_AFTER_MS should be positive and not greater than POLLING_MAX_PULL_AGAIN_AFTER_MS")
+	}
+	if c.PollingActiveChatSec < 0 || c.PollingIdleChatSec <= c.PollingActiveChatSec {
+		problems = append(problems, "POLLING_ACTIVE_CHAT_SEC can not be negative and should be less than POLLING_IDLE_CHAT_SEC")
+	}
+	if c.PollingSlowLatencyMs <= 0 {
+		problems = append(problems, "POLLING_SLOW_LATENCY_MS should be positive")
+	}
+	return problems
+}
+
+//String hides secret values, so config can be logged
+func (c Config) String() string {
+	value := reflect.ValueOf(c)
+	configType := value.Type()
+	parts := make([]string, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		fieldValue := fmt.Sprint(value.Field(i).Interface())
+		if field.Tag.Get("secret") == "true" && len(fieldValue) != 0 {
+			fieldValue = "***"
+		}
+		parts = append(parts, fmt.Sprintf("%s = [%s]", field.Tag.Get("env"), fieldValue))
+	}
+	return strings.Join(parts, ", ")
+}
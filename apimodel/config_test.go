@@ -0,0 +1,139 @@
+package apimodel
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		env           map[string]string
+		checkRequired bool
+		//substring of the error, empty when config is valid
+		problem string
+		check   func(t *testing.T, config Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, config Config) {
+				if config.FallbackMaxAgeSec != 3600 || !config.FallbackEnabled {
+					t.Errorf("fallback is [%v] with max age [%d], want enabled with default max age", config.FallbackEnabled, config.FallbackMaxAgeSec)
+				}
+			},
+		},
+		{
+			name: "number from file",
+			file: `{"FALLBACK_MAX_AGE_SEC": 1000000, "FALLBACK_ENABLED": false}`,
+			check: func(t *testing.T, config Config) {
+				if config.FallbackMaxAgeSec != 1000000 {
+					t.Errorf("max age is [%d], want [1000000]", config.FallbackMaxAgeSec)
+				}
+				if config.FallbackEnabled {
+					t.Errorf("fallback is enabled, want disabled")
+				}
+			},
+		},
+		{
+			name: "object from file",
+			file: `{"RATE_LIMITS": {"get_lc": {"perUser": {"perMinute": 7, "burst": 2}}}}`,
+			check: func(t *testing.T, config Config) {
+				limits, err := parseRateLimits(config.RateLimits)
+				if err != nil {
+					t.Fatalf("error parsing rate limits [%s] : %v", config.RateLimits, err)
+				}
+				if limits["get_lc"].PerUser != (RateLimit{PerMinute: 7, Burst: 2}) {
+					t.Errorf("get_lc per user limit is %+v, want 7 per minute with burst 2", limits["get_lc"].PerUser)
+				}
+			},
+		},
+		{
+			name: "env wins over file",
+			file: `{"ENV": "test", "FALLBACK_MAX_SIZE": 10}`,
+			env:  map[string]string{"ENV": "prod"},
+			check: func(t *testing.T, config Config) {
+				if config.Env != "prod" || config.FallbackMaxSize != 10 {
+					t.Errorf("env is [%s] and max size is [%d], want [prod] and [10]", config.Env, config.FallbackMaxSize)
+				}
+			},
+		},
+		{
+			name:    "unknown key in file",
+			file:    `{"FALLBACK_MAX_AGE": 60}`,
+			problem: "CONFIG_FILE contains unknown key FALLBACK_MAX_AGE",
+		},
+		{
+			name:    "broken file",
+			file:    `{"FALLBACK_MAX_AGE_SEC": `,
+			problem: "error parsing CONFIG_FILE",
+		},
+		{
+			name:    "wrong value",
+			env:     map[string]string{"FALLBACK_MAX_AGE_SEC": "1h"},
+			problem: "FALLBACK_MAX_AGE_SEC has wrong value [1h]",
+		},
+		{
+			name:    "not valid value",
+			file:    `{"FALLBACK_MAX_AGE_SEC": 0}`,
+			problem: "FALLBACK_MAX_AGE_SEC should be positive",
+		},
+		{
+			name:          "required value",
+			env:           map[string]string{"ENV": "test"},
+			checkRequired: true,
+			problem:       "INTERNAL_AUTH_FUNCTION_NAME can not be empty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.file) != 0 {
+				fileName := writeConfigFile(t, test.file)
+				defer os.Remove(fileName)
+				setEnv(t, ConfigFileEnv, fileName)
+			}
+			for key, value := range test.env {
+				setEnv(t, key, value)
+			}
+			//papertrail needs an address
+			config, err := loadConfig(Config{LogBackend: LogBackendJSON}, test.checkRequired)
+			if len(test.problem) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.problem) {
+					t.Fatalf("error is %v, want [%s]", err, test.problem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error loading config : %v", err)
+			}
+			test.check(t, config)
+		})
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "feeds-config-")
+	if err != nil {
+		t.Fatalf("error creating config file : %v", err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(content); err != nil {
+		t.Fatalf("error writing config file : %v", err)
+	}
+	return file.Name()
+}
+
+//setEnv sets the var until the end of the test
+func setEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+			return
+		}
+		os.Unsetenv(key)
+	})
+}
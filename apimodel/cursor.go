@@ -0,0 +1,35 @@
+package apimodel
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+//FeedCursor points to the next page inside the section by the last profile of the previous page,
+//so the page starts right after it even if profiles before it were added or removed. Offset is used
+//only when that profile is not in the section anymore. Clients should treat it as an opaque string.
+type FeedCursor struct {
+	Section    string `json:"s"`
+	Offset     int    `json:"o"`
+	LastUserId string `json:"u,omitempty"`
+}
+
+func EncodeFeedCursor(cursor FeedCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+//DecodeFeedCursor returns ok=false if cursor is malformed, belongs to another section or its offset
+//is out of [0, maxOffset], which is the deepest page the section can have
+func DecodeFeedCursor(section, cursor string, maxOffset int) (FeedCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return FeedCursor{}, false
+	}
+	var feedCursor FeedCursor
+	err = json.Unmarshal(data, &feedCursor)
+	if err != nil || feedCursor.Section != section || feedCursor.Offset < 0 || feedCursor.Offset > maxOffset {
+		return FeedCursor{}, false
+	}
+	return feedCursor, true
+}
@@ -0,0 +1,74 @@
+package apimodel
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeFeedCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		cursor  string
+		want    FeedCursor
+		ok      bool
+	}{
+		{
+			name:    "next page",
+			section: LikesYouSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: LikesYouSection, Offset: 20, LastUserId: "u19"}),
+			want:    FeedCursor{Section: LikesYouSection, Offset: 20, LastUserId: "u19"},
+			ok:      true,
+		},
+		{
+			name:    "without last user id",
+			section: MessagesSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: MessagesSection, Offset: 5}),
+			want:    FeedCursor{Section: MessagesSection, Offset: 5},
+			ok:      true,
+		},
+		{
+			name:    "deepest page",
+			section: LikesYouSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: LikesYouSection, Offset: 100}),
+			want:    FeedCursor{Section: LikesYouSection, Offset: 100},
+			ok:      true,
+		},
+		{
+			name:    "cursor of another section",
+			section: MessagesSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: LikesYouSection, Offset: 20}),
+		},
+		{
+			name:    "offset is out of range",
+			section: LikesYouSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: LikesYouSection, Offset: 101}),
+		},
+		{
+			name:    "negative offset",
+			section: LikesYouSection,
+			cursor:  EncodeFeedCursor(FeedCursor{Section: LikesYouSection, Offset: -1}),
+		},
+		{
+			name:    "not base64",
+			section: LikesYouSection,
+			cursor:  "!!!",
+		},
+		{
+			name:    "not json",
+			section: LikesYouSection,
+			cursor:  base64.RawURLEncoding.EncodeToString([]byte("20")),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := DecodeFeedCursor(test.section, test.cursor, 100)
+			if ok != test.ok {
+				t.Fatalf("ok is %v, want %v", ok, test.ok)
+			}
+			if result != test.want {
+				t.Errorf("cursor is %+v, want %+v", result, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"math"
+	"strings"
+)
+
+type DistanceUnit string
+
+const (
+	//empty unit means the unit is selected by the viewer's locale
+	DistanceUnitAuto       DistanceUnit = ""
+	DistanceUnitKilometers DistanceUnit = "km"
+	DistanceUnitMiles      DistanceUnit = "mi"
+
+	DistanceUnitParam = "distanceUnit"
+	//ISO 3166 country code of the viewer, source locale of the profile is usually a bare language
+	RegionParam  = "region"
+	RegionHeader = "x-ringoid-region"
+
+	metersInMile = 1609.344
+)
+
+//regions where distance is measured in miles
+var milesRegions = map[string]bool{
+	"us": true,
+	"gb": true,
+	"lr": true,
+	"mm": true,
+}
+
+type distanceUnitBody struct {
+	DistanceUnit string `json:"distanceUnit"`
+	Region       string `json:"region"`
+}
+
+//ParseDistanceUnit returns unit and ok=false if the value is not supported
+func ParseDistanceUnit(value string) (DistanceUnit, bool) {
+	switch DistanceUnit(strings.ToLower(strings.TrimSpace(value))) {
+	case DistanceUnitKilometers:
+		return DistanceUnitKilometers, true
+	case DistanceUnitMiles:
+		return DistanceUnitMiles, true
+	}
+	return DistanceUnitAuto, false
+}
+
+//DistanceUnitFromQuery reads optional distanceUnit query param, without it the unit is selected by region param
+//or header, unsupported value or unknown region means auto
+func DistanceUnitFromQuery(params map[string]string, headers map[string]string, lc *lambdacontext.LambdaContext) DistanceUnit {
+	if value, ok := params[DistanceUnitParam]; ok {
+		return distanceUnitFromValue(value, lc)
+	}
+	region, ok := params[RegionParam]
+	if !ok {
+		region = headers[RegionHeader]
+	}
+	return DistanceUnitForRegion(region)
+}
+
+//DistanceUnitFromBody is DistanceUnitFromQuery for json request body
+func DistanceUnitFromBody(body string, headers map[string]string, lc *lambdacontext.LambdaContext) DistanceUnit {
+	var req distanceUnitBody
+	json.Unmarshal([]byte(body), &req)
+	if len(req.DistanceUnit) != 0 {
+		return distanceUnitFromValue(req.DistanceUnit, lc)
+	}
+	region := req.Region
+	if len(region) == 0 {
+		region = headers[RegionHeader]
+	}
+	return DistanceUnitForRegion(region)
+}
+
+func distanceUnitFromValue(value string, lc *lambdacontext.LambdaContext) DistanceUnit {
+	unit, ok := ParseDistanceUnit(value)
+	if !ok {
+		Anlogger.Warnf(lc, "distance_units.go : distance unit [%s] is not supported, so select unit by locale", value)
+	}
+	return unit
+}
+
+//DistanceUnitForRegion returns unit of the country, auto for empty region
+func DistanceUnitForRegion(region string) DistanceUnit {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if len(region) == 0 {
+		return DistanceUnitAuto
+	}
+	if milesRegions[region] {
+		return DistanceUnitMiles
+	}
+	return DistanceUnitKilometers
+}
+
+//DistanceUnitForLocale returns miles for locales with miles region (en-US, en_GB), km otherwise, so bare language
+//is always km and the client should send its region
+func DistanceUnitForLocale(locale string) DistanceUnit {
+	parts := strings.Split(normalizeLocale(locale), "-")
+	if len(parts) > 1 && milesRegions[parts[len(parts)-1]] {
+		return DistanceUnitMiles
+	}
+	return DistanceUnitKilometers
+}
+
+//FormatDistance returns localized distance text, unit auto is resolved by locale.
+//km and mi are rounded the same way: "less than 1" under one unit, whole units rounded down otherwise
+func FormatDistance(meters float64, unit DistanceUnit, locale string) string {
+	if unit == DistanceUnitAuto {
+		unit = DistanceUnitForLocale(locale)
+	}
+	value, key, lessThanKey := meters/1000, "distance.km", "distance.lessThanKm"
+	if unit == DistanceUnitMiles {
+		value, key, lessThanKey = meters/metersInMile, "distance.mi", "distance.lessThanMi"
+	}
+	if value < 1 {
+		return Localization.Text(locale, lessThanKey, 1)
+	}
+	return Localization.Text(locale, key, int64(math.Floor(value)))
+}
@@ -0,0 +1,30 @@
+package apimodel
+
+import "testing"
+
+func TestFormatDistance(t *testing.T) {
+	tests := []struct {
+		name   string
+		meters float64
+		unit   DistanceUnit
+		locale string
+		want   string
+	}{
+		{name: "under one km", meters: 400, unit: DistanceUnitKilometers, locale: "en", want: "less than 1 km"},
+		{name: "under one mi", meters: 1500, unit: DistanceUnitMiles, locale: "en", want: "less than 1 mi"},
+		{name: "exactly one km", meters: 1000, unit: DistanceUnitKilometers, locale: "en", want: "1 km"},
+		{name: "km rounded down", meters: 2999, unit: DistanceUnitKilometers, locale: "en", want: "2 km"},
+		{name: "mi rounded down", meters: 2 * metersInMile * 1.9, unit: DistanceUnitMiles, locale: "en", want: "3 mi"},
+		{name: "auto by locale region", meters: 800, unit: DistanceUnitAuto, locale: "en_US", want: "less than 1 mi"},
+		{name: "auto bare language is km", meters: 5500, unit: DistanceUnitAuto, locale: "en", want: "5 km"},
+		{name: "plural form of mi", meters: 5.5 * metersInMile, unit: DistanceUnitMiles, locale: "ru", want: "5 миль"},
+		{name: "under one mi localized", meters: 100, unit: DistanceUnitMiles, locale: "ru", want: "меньше 1 мили"},
+	}
+	for _, each := range tests {
+		t.Run(each.name, func(t *testing.T) {
+			if got := FormatDistance(each.meters, each.unit, each.locale); got != each.want {
+				t.Errorf("FormatDistance(%v, %q, %q) = %q, want %q", each.meters, each.unit, each.locale, got, each.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package apimodel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"encoding/json"
+	"io/ioutil"
+	"github.com/ringoid/commons"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+//FakeFeedsBackend keeps canned internal responses in memory. Zero LastActionTime in a canned
+//response is replaced with the current time, so handlers never ask the client to repeat the request.
+type FakeFeedsBackend struct {
+	mu sync.Mutex
+
+	//access token to user id, unknown tokens are used as user id
+	Tokens map[string]string `json:"tokens"`
+
+	NewFacesResp commons.InternalGetNewFacesResp `json:"newFaces"`
+	DiscoverResp commons.InternalGetNewFacesResp `json:"discover"`
+	//by function name
+	LCResp map[string]commons.InternalGetLCResp `json:"lc"`
+	//by FakeLMMKey
+	LMMResp map[string]commons.InternalLMMResp `json:"lmm"`
+	//by FakeLMHISKey
+	LMHISResp map[string]commons.InternalLMHISResp `json:"lmhis"`
+	//by opposite user id
+	ChatResp map[string]commons.InternalChatResponse `json:"chats"`
+
+	//function names which should fail with InternalServerError
+	FailingFunctions map[string]bool `json:"failingFunctions"`
+	//user ids for which prepare new faces was requested
+	PreparedNewFacesFor []string `json:"-"`
+}
+
+func NewFakeFeedsBackend() *FakeFeedsBackend {
+	return &FakeFeedsBackend{
+		Tokens:           make(map[string]string),
+		LCResp:           make(map[string]commons.InternalGetLCResp),
+		LMMResp:          make(map[string]commons.InternalLMMResp),
+		LMHISResp:        make(map[string]commons.InternalLMHISResp),
+		ChatResp:         make(map[string]commons.InternalChatResponse),
+		FailingFunctions: make(map[string]bool),
+	}
+}
+
+func FakeLMMKey(functionName string, requestNewPart bool) string {
+	return fmt.Sprintf("%s_%v", functionName, requestNewPart)
+}
+
+func FakeLMHISKey(functionName, lmhisPart string, requestNewPart bool) string {
+	return fmt.Sprintf("%s_%s_%v", functionName, lmhisPart, requestNewPart)
+}
+
+//LoadFakeFeedsBackend reads canned responses from json file, keys are the same as FakeFeedsBackend json tags
+func LoadFakeFeedsBackend(fileName string) (*FakeFeedsBackend, error) {
+	b := NewFakeFeedsBackend()
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *FakeFeedsBackend) VerifyAccessToken(ctx context.Context, appVersion int, isItAndroid bool, accessToken string, lc *lambdacontext.LambdaContext) (string, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if userId, ok := b.Tokens[accessToken]; ok {
+		return userId, true, ""
+	}
+	return accessToken, true, ""
+}
+
+func (b *FakeFeedsBackend) GetNewFaces(ctx context.Context, req commons.InternalGetNewFacesReq, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalGetNewFacesResp{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[Settings().GetNewFacesFunctionName] {
+		return commons.InternalGetNewFacesResp{}, false, commons.InternalServerError
+	}
+	resp := b.NewFacesResp
+	if len(resp.NewFaces) > req.Limit {
+		resp.NewFaces = resp.NewFaces[:req.Limit]
+	}
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) Discover(ctx context.Context, req *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalGetNewFacesResp{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[Settings().DiscoverFunctionName] {
+		return commons.InternalGetNewFacesResp{}, false, commons.InternalServerError
+	}
+	resp := b.DiscoverResp
+	if req.Limit != nil && len(resp.NewFaces) > *req.Limit {
+		resp.NewFaces = resp.NewFaces[:*req.Limit]
+	}
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) GetLC(ctx context.Context, functionName string, req *commons.GetLCRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetLCResp, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalGetLCResp{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[functionName] {
+		return commons.InternalGetLCResp{}, false, commons.InternalServerError
+	}
+	resp := b.LCResp[functionName]
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	if req.Limit != nil && len(resp.Profiles) > *req.Limit {
+		resp.Profiles = resp.Profiles[:*req.Limit]
+	}
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) LMM(ctx context.Context, functionName string, req commons.InternalLMMReq, lc *lambdacontext.LambdaContext) (commons.InternalLMMResp, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalLMMResp{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[functionName] {
+		return commons.InternalLMMResp{}, false, commons.InternalServerError
+	}
+	resp := b.LMMResp[FakeLMMKey(functionName, req.RequestNewPart)]
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) LMHIS(ctx context.Context, functionName string, req commons.InternalLMHISReq, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalLMHISResp{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[functionName] {
+		return commons.InternalLMHISResp{}, false, commons.InternalServerError
+	}
+	resp := b.LMHISResp[FakeLMHISKey(functionName, req.LMHISPart, req.RequestNewPart)]
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) Chat(ctx context.Context, req commons.InternalChatRequest, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return commons.InternalChatResponse{}, false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[Settings().ChatFunctionName] {
+		return commons.InternalChatResponse{}, false, commons.InternalServerError
+	}
+	resp, ok := b.ChatResp[req.OppositeUserId]
+	if !ok {
+		resp.Profile.UserId = req.OppositeUserId
+	}
+	resp.LastActionTime = fakeLastActionTime(resp.LastActionTime)
+	return resp, true, ""
+}
+
+func (b *FakeFeedsBackend) PrepareNewFaces(ctx context.Context, req commons.InternalPrepareNewFacesReq, lc *lambdacontext.LambdaContext) (bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return false, internalCallErrorStr(ctx)
+	}
+	if b.FailingFunctions[Settings().PrepareNewFacesFunctionName] {
+		return false, commons.InternalServerError
+	}
+	b.PreparedNewFacesFor = append(b.PreparedNewFacesFor, req.UserId)
+	return true, ""
+}
+
+func fakeLastActionTime(lastActionTime int64) int64 {
+	if lastActionTime == 0 {
+		return commons.UnixTimeInMillis()
+	}
+	return lastActionTime
+}
@@ -0,0 +1,286 @@
+package apimodel
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//clients come back soon to get fresh feed when backend is available again
+	staleRepeatRequestAfter = int64(3000)
+)
+
+//StaleResponse is a response which can be served from the fallback store
+type StaleResponse interface {
+	MarkStale(repeatRequestAfter int64)
+}
+
+//FallbackStore is a persistent cache of the last good responses, e.g. in file system or s3.
+//Load returns the time when the response was saved.
+type FallbackStore interface {
+	Load(key string) ([]byte, time.Time, bool, error)
+	Save(key string, data []byte) error
+	Delete(key string) error
+	//DeleteOlderThan removes all responses saved before the time
+	DeleteOlderThan(before time.Time) error
+}
+
+//FileFallbackStore keeps each response in own file of the dir, file name is a hash of the key
+type FileFallbackStore struct {
+	Dir string
+}
+
+func (s FileFallbackStore) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+//Load uses modification time of the file as the time when the response was saved
+func (s FileFallbackStore) Load(key string) ([]byte, time.Time, bool, error) {
+	fileName := s.fileName(key)
+	info, err := os.Stat(fileName)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("error reading fallback file : %v", err)
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("error reading fallback file : %v", err)
+	}
+	return data, info.ModTime(), true, nil
+}
+
+func (s FileFallbackStore) Save(key string, data []byte) error {
+	//write and rename, so reader never sees half of the file
+	tmp, err := ioutil.TempFile(s.Dir, "fallback-")
+	if err != nil {
+		return fmt.Errorf("error creating fallback file : %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing fallback file : %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error closing fallback file : %v", err)
+	}
+	if err = os.Rename(tmp.Name(), s.fileName(key)); err != nil {
+		return fmt.Errorf("error renaming fallback file : %v", err)
+	}
+	return nil
+}
+
+func (s FileFallbackStore) Delete(key string) error {
+	err := os.Remove(s.fileName(key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting fallback file : %v", err)
+	}
+	return nil
+}
+
+func (s FileFallbackStore) DeleteOlderThan(before time.Time) error {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return fmt.Errorf("error reading fallback dir : %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") || !file.ModTime().Before(before) {
+			continue
+		}
+		err = os.Remove(filepath.Join(s.Dir, file.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error deleting fallback file : %v", err)
+		}
+	}
+	return nil
+}
+
+//FeedFallback keeps the last good response of the feed per user in container memory (LRU) and in optional store.
+//Responses older than maxAge are never served and are deleted from the store.
+type FeedFallback struct {
+	enabled bool
+	store   FallbackStore
+	maxSize int
+	maxAge  time.Duration
+
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List
+	lastCleanup time.Time
+}
+
+type fallbackEntry struct {
+	key     string
+	data    []byte
+	savedAt time.Time
+}
+
+//Fallback is disabled until InitFallback
+var Fallback = &FeedFallback{}
+
+func NewFeedFallback(store FallbackStore, maxSize int, maxAge time.Duration) *FeedFallback {
+	return &FeedFallback{enabled: true, store: store, maxSize: maxSize, maxAge: maxAge, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func InitFallback(config Config) error {
+	if !config.FallbackEnabled {
+		Fallback = &FeedFallback{}
+		return nil
+	}
+	maxAge := time.Duration(config.FallbackMaxAgeSec) * time.Second
+	var store FallbackStore
+	if len(config.FallbackDir) != 0 {
+		err := os.MkdirAll(config.FallbackDir, 0700)
+		if err != nil {
+			return fmt.Errorf("error creating fallback dir [%s] : %v", config.FallbackDir, err)
+		}
+		store = FileFallbackStore{Dir: config.FallbackDir}
+		//responses left by previous runs
+		err = store.DeleteOlderThan(time.Now().Add(-maxAge))
+		if err != nil {
+			return fmt.Errorf("error deleting old responses from fallback dir [%s] : %v", config.FallbackDir, err)
+		}
+	}
+	Fallback = NewFeedFallback(store, config.FallbackMaxSize, maxAge)
+	Fallback.lastCleanup = time.Now()
+	return nil
+}
+
+//the feed doesn't depend on lastActionTime, the last good one is good for any
+func fallbackKey(key CoalesceKey) string {
+	key.LastActionTime = 0
+	return key.String()
+}
+
+//IsBackendError is true when the request failed because internal functions are unavailable, not because of the client
+func IsBackendError(errStr string) bool {
+	switch errStr {
+	case commons.InternalServerError, InternalServiceTimeoutError, InternalServiceCrashError, InternalServiceFunctionError:
+		return true
+	}
+	return false
+}
+
+//Remember keeps marshaled complete response
+func (f *FeedFallback) Remember(key CoalesceKey, body []byte, lc *lambdacontext.LambdaContext) {
+	if !f.enabled {
+		return
+	}
+	k := fallbackKey(key)
+	now := time.Now()
+	f.put(k, body, now)
+	if f.store == nil {
+		return
+	}
+	if err := f.store.Save(k, body); err != nil {
+		Anlogger.Warnf(lc, "fallback.go : error saving [%s] feed of userId [%s] : %v", key.Endpoint, key.UserId, err)
+	}
+	if f.cleanupDue(now) {
+		if err := f.store.DeleteOlderThan(now.Add(-f.maxAge)); err != nil {
+			Anlogger.Warnf(lc, "fallback.go : error deleting old responses : %v", err)
+		}
+	}
+}
+
+//Recall fills resp with the last good response marked as stale, false if there is nothing
+func (f *FeedFallback) Recall(key CoalesceKey, resp StaleResponse, lc *lambdacontext.LambdaContext) bool {
+	if !f.enabled {
+		return false
+	}
+	k := fallbackKey(key)
+	data, savedAt, ok := f.get(k)
+	if !ok && f.store != nil {
+		var err error
+		data, savedAt, ok, err = f.store.Load(k)
+		if err != nil {
+			Anlogger.Warnf(lc, "fallback.go : error loading [%s] feed of userId [%s] : %v", key.Endpoint, key.UserId, err)
+		}
+	}
+	if !ok {
+		return false
+	}
+	if age := time.Since(savedAt); age > f.maxAge {
+		Anlogger.Debugf(lc, "fallback.go : last good [%s] feed of userId [%s] is [%v] old, it is too old to serve", key.Endpoint, key.UserId, age)
+		f.forget(k, lc)
+		return false
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		Anlogger.Warnf(lc, "fallback.go : error unmarshaling [%s] feed of userId [%s] : %v", key.Endpoint, key.UserId, err)
+		return false
+	}
+	resp.MarkStale(staleRepeatRequestAfter)
+	return true
+}
+
+func (f *FeedFallback) get(key string) ([]byte, time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	element, ok := f.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	f.order.MoveToFront(element)
+	entry := element.Value.(*fallbackEntry)
+	return entry.data, entry.savedAt, true
+}
+
+func (f *FeedFallback) put(key string, data []byte, savedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if element, ok := f.entries[key]; ok {
+		entry := element.Value.(*fallbackEntry)
+		entry.data = data
+		entry.savedAt = savedAt
+		f.order.MoveToFront(element)
+		return
+	}
+	for f.order.Len() >= f.maxSize && f.order.Len() != 0 {
+		oldest := f.order.Back()
+		f.order.Remove(oldest)
+		delete(f.entries, oldest.Value.(*fallbackEntry).key)
+	}
+	f.entries[key] = f.order.PushFront(&fallbackEntry{key: key, data: data, savedAt: savedAt})
+}
+
+//forget deletes too old response from memory and the store
+func (f *FeedFallback) forget(key string, lc *lambdacontext.LambdaContext) {
+	f.mu.Lock()
+	if element, ok := f.entries[key]; ok {
+		f.order.Remove(element)
+		delete(f.entries, key)
+	}
+	f.mu.Unlock()
+	if f.store == nil {
+		return
+	}
+	if err := f.store.Delete(key); err != nil {
+		Anlogger.Warnf(lc, "fallback.go : error deleting too old response : %v", err)
+	}
+}
+
+//cleanupDue is true once per max age, so the store never keeps responses much longer than that
+func (f *FeedFallback) cleanupDue(now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.lastCleanup) < f.maxAge {
+		return false
+	}
+	f.lastCleanup = now
+	return true
+}
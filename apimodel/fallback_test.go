@@ -0,0 +1,101 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func marshalFeed(t *testing.T, resp interface{}) []byte {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestFeedFallbackRecall(t *testing.T) {
+	fallback := NewFeedFallback(nil, 10, time.Hour)
+	key := CoalesceKey{Endpoint: "lmhis", UserId: "u1", LastActionTime: 100}
+	fallback.Remember(key, marshalFeed(t, LMHISFeedResp{}), nil)
+
+	//any lastActionTime gets the last good feed
+	key.LastActionTime = 200
+	resp := &LMHISFeedResp{}
+	if !fallback.Recall(key, resp, nil) {
+		t.Fatalf("remembered feed was not recalled")
+	}
+	if !resp.Stale || resp.RepeatRequestAfter != staleRepeatRequestAfter {
+		t.Errorf("recalled feed is not marked stale : stale %v, repeatRequestAfter %d", resp.Stale, resp.RepeatRequestAfter)
+	}
+
+	other := CoalesceKey{Endpoint: "lmhis", UserId: "u2"}
+	if fallback.Recall(other, &LMHISFeedResp{}, nil) {
+		t.Errorf("feed of another user was recalled")
+	}
+}
+
+func TestFeedFallbackMaxAge(t *testing.T) {
+	const maxAge = 50 * time.Millisecond
+	fallback := NewFeedFallback(nil, 10, maxAge)
+	key := CoalesceKey{Endpoint: "get_lc", UserId: "u1"}
+	fallback.Remember(key, marshalFeed(t, GetLcFeedResp{}), nil)
+
+	time.Sleep(maxAge + 30*time.Millisecond)
+	if fallback.Recall(key, &GetLcFeedResp{}, nil) {
+		t.Errorf("feed older than max age was recalled")
+	}
+	if _, _, ok := fallback.get(fallbackKey(key)); ok {
+		t.Errorf("too old feed was not forgotten")
+	}
+}
+
+func TestFeedFallbackEvictsLeastRecentlyUsed(t *testing.T) {
+	fallback := NewFeedFallback(nil, 2, time.Hour)
+	keys := []CoalesceKey{{Endpoint: "lmhis", UserId: "u1"}, {Endpoint: "lmhis", UserId: "u2"}, {Endpoint: "lmhis", UserId: "u3"}}
+	fallback.Remember(keys[0], marshalFeed(t, LMHISFeedResp{}), nil)
+	fallback.Remember(keys[1], marshalFeed(t, LMHISFeedResp{}), nil)
+	//u1 is used, so u2 is the oldest one
+	fallback.Recall(keys[0], &LMHISFeedResp{}, nil)
+	fallback.Remember(keys[2], marshalFeed(t, LMHISFeedResp{}), nil)
+
+	for i, want := range []bool{true, false, true} {
+		if got := fallback.Recall(keys[i], &LMHISFeedResp{}, nil); got != want {
+			t.Errorf("recall of %s is %v, want %v", keys[i].UserId, got, want)
+		}
+	}
+}
+
+func TestFeedFallbackFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feeds-fallback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileFallbackStore{Dir: dir}
+	key := CoalesceKey{Endpoint: "get_lc", UserId: "u1"}
+	NewFeedFallback(store, 10, time.Hour).Remember(key, marshalFeed(t, GetLcFeedResp{AllMessagesProfilesNum: 7}), nil)
+
+	//new container has nothing in memory
+	resp := &GetLcFeedResp{}
+	if !NewFeedFallback(store, 10, time.Hour).Recall(key, resp, nil) {
+		t.Fatalf("feed saved by another container was not recalled")
+	}
+	if resp.AllMessagesProfilesNum != 7 || !resp.Stale {
+		t.Errorf("unexpected recalled feed %v", resp)
+	}
+
+	//too old file is deleted on recall
+	old := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(store.fileName(fallbackKey(key)), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if NewFeedFallback(store, 10, time.Hour).Recall(key, &GetLcFeedResp{}, nil) {
+		t.Errorf("feed older than max age was recalled from the file")
+	}
+	if _, _, ok, _ := store.Load(fallbackKey(key)); ok {
+		t.Errorf("too old file was not deleted")
+	}
+}
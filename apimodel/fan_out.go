@@ -0,0 +1,49 @@
+package apimodel
+
+import (
+	"context"
+	"sync"
+)
+
+//FanOut is shared by parallel internal calls of one request. It remembers the first error
+//and, if cancelOnFail is set, cancels the rest of the calls because their result is not needed anymore.
+type FanOut struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	cancelOnFail bool
+
+	mu     sync.Mutex
+	errStr string
+}
+
+func NewFanOut(ctx context.Context, cancelOnFail bool) *FanOut {
+	fanOutCtx, cancel := context.WithCancel(ctx)
+	return &FanOut{ctx: fanOutCtx, cancel: cancel, cancelOnFail: cancelOnFail}
+}
+
+func (f *FanOut) Context() context.Context {
+	return f.ctx
+}
+
+func (f *FanOut) Fail(errStr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.errStr) != 0 {
+		return
+	}
+	f.errStr = errStr
+	if f.cancelOnFail {
+		f.cancel()
+	}
+}
+
+//error string of the first failed call, empty if there were no failures
+func (f *FanOut) ErrStr() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.errStr
+}
+
+func (f *FanOut) Cancel() {
+	f.cancel()
+}
@@ -0,0 +1,209 @@
+package apimodel
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//age is replaced with 0 in all returned profiles
+	HideAgeFlag = "hide-age"
+
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+
+	//refresh is made in the request, so it should not take much of its time
+	flagsRefreshTimeout = 300 * time.Millisecond
+)
+
+//FeatureFlag is enabled for the viewer when it is enabled and there are no rules or any of the rules matches
+type FeatureFlag struct {
+	Enabled bool       `json:"enabled"`
+	Rules   []FlagRule `json:"rules"`
+}
+
+//FlagRule matches when all set conditions match
+type FlagRule struct {
+	UserIds        []string `json:"userIds,omitempty"`
+	ExcludeUserIds []string `json:"excludeUserIds,omitempty"`
+	//0-100, users are bucketed by hash of flag name and userId, so the same users stay in
+	Percentage    *int     `json:"percentage,omitempty"`
+	MinAppVersion int      `json:"minAppVersion,omitempty"`
+	Platforms     []string `json:"platforms,omitempty"`
+}
+
+//FlagContext is who asks, viewer of the feed
+type FlagContext struct {
+	UserId      string
+	AppVersion  int
+	IsItAndroid bool
+}
+
+func (c FlagContext) Platform() string {
+	if c.IsItAndroid {
+		return PlatformAndroid
+	}
+	return PlatformIOS
+}
+
+//FlagStore returns the whole flags document, flag name -> flag
+type FlagStore interface {
+	Load(ctx context.Context) (map[string]FeatureFlag, error)
+}
+
+type FileFlagStore struct {
+	FileName string
+}
+
+func (s FileFlagStore) Load(ctx context.Context) (map[string]FeatureFlag, error) {
+	data, err := ioutil.ReadFile(s.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feature flags file [%s] : %v", s.FileName, err)
+	}
+	return parseFlags(data)
+}
+
+type S3FlagStore struct {
+	Client *s3.S3
+	Bucket string
+	Key    string
+}
+
+func (s S3FlagStore) Load(ctx context.Context) (map[string]FeatureFlag, error) {
+	output, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting feature flags from s3://%s/%s : %v", s.Bucket, s.Key, err)
+	}
+	defer output.Body.Close()
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feature flags from s3://%s/%s : %v", s.Bucket, s.Key, err)
+	}
+	return parseFlags(data)
+}
+
+func parseFlags(data []byte) (map[string]FeatureFlag, error) {
+	var flags map[string]FeatureFlag
+	err := json.Unmarshal(data, &flags)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing feature flags : %v", err)
+	}
+	return flags, nil
+}
+
+//FeatureFlags keeps the last loaded document and reloads it when it is older than refresh interval,
+//without store all flags are disabled. Reload is made by the request which found the document stale,
+//lambda freezes goroutines which outlive the request.
+type FeatureFlags struct {
+	store      FlagStore
+	refresh    time.Duration
+	mu         sync.RWMutex
+	flags      map[string]FeatureFlag
+	loadedAt   time.Time
+	refreshing int32
+}
+
+var Flags = NewFeatureFlags(nil, 0)
+
+func NewFeatureFlags(store FlagStore, refresh time.Duration) *FeatureFlags {
+	return &FeatureFlags{store: store, refresh: refresh, flags: make(map[string]FeatureFlag)}
+}
+
+//Refresh loads flags from the store, previous flags are kept on error
+func (f *FeatureFlags) Refresh(ctx context.Context) error {
+	if f.store == nil {
+		return nil
+	}
+	flags, err := f.store.Load(ctx)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	//try again only after refresh interval even if loading failed
+	f.loadedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	f.flags = flags
+	return nil
+}
+
+func (f *FeatureFlags) IsEnabled(name string, viewer FlagContext, lc *lambdacontext.LambdaContext) bool {
+	f.mu.RLock()
+	flag, ok := f.flags[name]
+	stale := f.store != nil && f.refresh > 0 && time.Since(f.loadedAt) > f.refresh
+	f.mu.RUnlock()
+
+	//concurrent requests use the flags they already have
+	if stale && atomic.CompareAndSwapInt32(&f.refreshing, 0, 1) {
+		ctx, cancel := context.WithTimeout(context.Background(), flagsRefreshTimeout)
+		err := f.Refresh(ctx)
+		cancel()
+		atomic.StoreInt32(&f.refreshing, 0)
+		if err != nil {
+			//the error is about the container, not the request
+			Anlogger.Errorf(nil, "feature_flags.go : error refreshing feature flags : %v", err)
+		}
+		f.mu.RLock()
+		flag, ok = f.flags[name]
+		f.mu.RUnlock()
+	}
+
+	if !ok || !flag.Enabled {
+		return false
+	}
+	if len(flag.Rules) == 0 {
+		return true
+	}
+	for _, rule := range flag.Rules {
+		if rule.matches(name, viewer) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r FlagRule) matches(name string, viewer FlagContext) bool {
+	if len(r.UserIds) != 0 && !contains(r.UserIds, viewer.UserId) {
+		return false
+	}
+	if contains(r.ExcludeUserIds, viewer.UserId) {
+		return false
+	}
+	if r.Percentage != nil && flagBucket(name, viewer.UserId) >= *r.Percentage {
+		return false
+	}
+	if r.MinAppVersion > 0 && viewer.AppVersion < r.MinAppVersion {
+		return false
+	}
+	if len(r.Platforms) != 0 && !contains(r.Platforms, viewer.Platform()) {
+		return false
+	}
+	return true
+}
+
+//stable bucket 0-99 of the user for the flag
+func flagBucket(name, userId string) int {
+	sum := sha1.Sum([]byte(name + ":" + userId))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	FunctionErrorTimeout = "timeout"
+	FunctionErrorPanic   = "panic"
+	FunctionErrorHandled = "handled"
+
+	InternalServiceCrashError    = `{"errorCode":"InternalServiceCrashError","errorMessage":"Internal service crashed"}`
+	InternalServiceFunctionError = `{"errorCode":"InternalServiceFunctionError","errorMessage":"Internal service error"}`
+
+	//error message of the function which was stopped by lambda after its timeout
+	lambdaTimeoutMessage = "Task timed out"
+	//lambda runtime errors, e.g. Runtime.ExitError when process was killed because of memory limit
+	lambdaRuntimeErrorTypePrefix = "Runtime."
+)
+
+//FunctionError is an error of the invoked function, lambda returns it with status 200 and FunctionError set
+type FunctionError struct {
+	//FunctionErrorTimeout, FunctionErrorPanic or FunctionErrorHandled
+	Kind string
+	//Handled or Unhandled, provided runtimes report every error as Unhandled
+	Header  string
+	Type    string
+	Message string
+}
+
+type functionErrorPayload struct {
+	ErrorMessage string          `json:"errorMessage"`
+	ErrorType    string          `json:"errorType"`
+	StackTrace   json.RawMessage `json:"stackTrace"`
+}
+
+//ParseFunctionError classifies the error by payload, go runtime adds stack trace only to panics
+func ParseFunctionError(header string, payload []byte) FunctionError {
+	var parsed functionErrorPayload
+	//payload which is not an error object is kept as message
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		parsed.ErrorMessage = string(payload)
+	}
+	result := FunctionError{Header: header, Type: parsed.ErrorType, Message: parsed.ErrorMessage}
+	switch {
+	case strings.Contains(parsed.ErrorMessage, lambdaTimeoutMessage):
+		result.Kind = FunctionErrorTimeout
+	case strings.HasPrefix(parsed.ErrorType, lambdaRuntimeErrorTypePrefix) || hasStackTrace(parsed.StackTrace):
+		result.Kind = FunctionErrorPanic
+	default:
+		result.Kind = FunctionErrorHandled
+	}
+	return result
+}
+
+func hasStackTrace(raw json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	return len(trimmed) != 0 && trimmed != "null" && trimmed != "[]"
+}
+
+//Retryable is true only for timeout, the next call can get a warm container
+func (e FunctionError) Retryable() bool {
+	return e.Kind == FunctionErrorTimeout
+}
+
+//ClientErrorStr is error string which is returned to the client
+func (e FunctionError) ClientErrorStr() string {
+	switch e.Kind {
+	case FunctionErrorTimeout:
+		return InternalServiceTimeoutError
+	case FunctionErrorPanic:
+		return InternalServiceCrashError
+	}
+	return InternalServiceFunctionError
+}
@@ -0,0 +1,80 @@
+package apimodel
+
+import (
+	"testing"
+)
+
+func TestParseFunctionError(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		kind        string
+		message     string
+		retryable   bool
+		clientError string
+	}{
+		{
+			name:        "timeout",
+			payload:     `{"errorMessage":"2019-05-10T10:00:00.000Z 1c2d Task timed out after 3.00 seconds"}`,
+			kind:        FunctionErrorTimeout,
+			message:     "2019-05-10T10:00:00.000Z 1c2d Task timed out after 3.00 seconds",
+			retryable:   true,
+			clientError: InternalServiceTimeoutError,
+		},
+		{
+			name:        "killed by memory limit",
+			payload:     `{"errorMessage":"signal: killed","errorType":"Runtime.ExitError"}`,
+			kind:        FunctionErrorPanic,
+			message:     "signal: killed",
+			clientError: InternalServiceCrashError,
+		},
+		{
+			name:        "panic with stack trace",
+			payload:     `{"errorMessage":"runtime error: index out of range","errorType":"runtimeError","stackTrace":[{"path":"main.go","line":10}]}`,
+			kind:        FunctionErrorPanic,
+			message:     "runtime error: index out of range",
+			clientError: InternalServiceCrashError,
+		},
+		{
+			name:        "returned error",
+			payload:     `{"errorMessage":"user not found","errorType":"errorString"}`,
+			kind:        FunctionErrorHandled,
+			message:     "user not found",
+			clientError: InternalServiceFunctionError,
+		},
+		{
+			name:        "returned error with empty stack trace",
+			payload:     `{"errorMessage":"user not found","errorType":"errorString","stackTrace":[]}`,
+			kind:        FunctionErrorHandled,
+			message:     "user not found",
+			clientError: InternalServiceFunctionError,
+		},
+		{
+			name:        "payload is not an error object",
+			payload:     `out of luck`,
+			kind:        FunctionErrorHandled,
+			message:     "out of luck",
+			clientError: InternalServiceFunctionError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := ParseFunctionError("Unhandled", []byte(test.payload))
+			if result.Kind != test.kind {
+				t.Errorf("kind is [%s], want [%s]", result.Kind, test.kind)
+			}
+			if result.Message != test.message {
+				t.Errorf("message is [%s], want [%s]", result.Message, test.message)
+			}
+			if result.Header != "Unhandled" {
+				t.Errorf("header is [%s], want [Unhandled]", result.Header)
+			}
+			if result.Retryable() != test.retryable {
+				t.Errorf("retryable is %v, want %v", result.Retryable(), test.retryable)
+			}
+			if result.ClientErrorStr() != test.clientError {
+				t.Errorf("client error is %s, want %s", result.ClientErrorStr(), test.clientError)
+			}
+		})
+	}
+}
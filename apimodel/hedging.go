@@ -0,0 +1,192 @@
+package apimodel
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	//latencies of the last successful calls of the section which are used for p95
+	hedgeLatencyWindow = 200
+	//unused budget is kept for a burst of at most this many hedges
+	hedgeMaxTokens = 10
+)
+
+//latencyWindow is a ring buffer of the last latencies
+type latencyWindow struct {
+	values []time.Duration
+	next   int
+}
+
+func (w *latencyWindow) observe(latency time.Duration) {
+	if len(w.values) < hedgeLatencyWindow {
+		w.values = append(w.values, latency)
+		return
+	}
+	w.values[w.next] = latency
+	w.next = (w.next + 1) % hedgeLatencyWindow
+}
+
+func (w *latencyWindow) p95() time.Duration {
+	sorted := make([]time.Duration, len(w.values))
+	copy(sorted, w.values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*95/100]
+}
+
+//Hedger makes a duplicate call when the first one is slower than p95 latency of the section and returns
+//whichever succeeds first, the other one is canceled. Every call earns BudgetPercent/100 of the hedge,
+//so hedges add at most BudgetPercent of calls. Latencies and budget are per container.
+type Hedger struct {
+	budgetPercent int
+	minDelay      time.Duration
+	minSamples    int
+
+	mu        sync.Mutex
+	latencies map[string]*latencyWindow
+	tokens    float64
+}
+
+type hedgeResult struct {
+	value  interface{}
+	ok     bool
+	errStr string
+	hedge  bool
+}
+
+func NewHedger(budgetPercent int, minDelay time.Duration, minSamples int) *Hedger {
+	return &Hedger{budgetPercent: budgetPercent, minDelay: minDelay, minSamples: minSamples, latencies: make(map[string]*latencyWindow)}
+}
+
+//hedgeDelay returns p95 of the section and takes the budget of this call, false if there are not enough samples yet
+func (h *Hedger) hedgeDelay(section string) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens += float64(h.budgetPercent) / 100
+	if h.tokens > hedgeMaxTokens {
+		h.tokens = hedgeMaxTokens
+	}
+	window, ok := h.latencies[section]
+	if !ok || len(window.values) < h.minSamples {
+		return 0, false
+	}
+	delay := window.p95()
+	if delay < h.minDelay {
+		delay = h.minDelay
+	}
+	return delay, true
+}
+
+func (h *Hedger) takeToken() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+func (h *Hedger) observe(section string, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	window, ok := h.latencies[section]
+	if !ok {
+		window = &latencyWindow{}
+		h.latencies[section] = window
+	}
+	window.observe(latency)
+}
+
+//Do calls fn and, if it is slow and there is budget, calls it once more
+func (h *Hedger) Do(ctx context.Context, functionName, section string, fn func(ctx context.Context) (interface{}, bool, string),
+	lc *lambdacontext.LambdaContext) (interface{}, bool, string) {
+	delay, hedgeable := h.hedgeDelay(section)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	call := func(hedge bool) {
+		start := time.Now()
+		value, ok, errStr := fn(ctx)
+		//latency of the canceled loser is unknown, so p95 is a bit optimistic, budget keeps it in check
+		if ok {
+			h.observe(section, time.Since(start))
+		}
+		results <- hedgeResult{value: value, ok: ok, errStr: errStr, hedge: hedge}
+	}
+	go call(false)
+
+	var timeout <-chan time.Time
+	if hedgeable {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	pending, hedged := 1, false
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			if !h.takeToken() {
+				Anlogger.Debugf(lc, "hedging.go : function [%s] is slower than [%v], but hedge budget is over", functionName, delay)
+				continue
+			}
+			Anlogger.Debugf(lc, "hedging.go : function [%s] is slower than [%v], make hedged call", functionName, delay)
+			trace.SpanFromContext(ctx).AddEvent("hedge")
+			pending++
+			hedged = true
+			go call(true)
+		case result := <-results:
+			pending--
+			if result.ok || pending == 0 {
+				if hedged {
+					Metrics.HedgedCall(functionName, result.ok && result.hedge)
+				}
+				return result.value, result.ok, result.errStr
+			}
+		}
+	}
+}
+
+//HedgingFeedsBackend hedges calls of get_lc and lmhis sections, other calls go directly to the next backend
+type HedgingFeedsBackend struct {
+	FeedsBackend
+	hedger *Hedger
+}
+
+func NewHedgingFeedsBackend(next FeedsBackend, hedger *Hedger) *HedgingFeedsBackend {
+	return &HedgingFeedsBackend{FeedsBackend: next, hedger: hedger}
+}
+
+func (b *HedgingFeedsBackend) GetLC(ctx context.Context, functionName string, req *commons.GetLCRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetLCResp, bool, string) {
+	value, ok, errStr := b.hedger.Do(ctx, functionName, functionName, func(ctx context.Context) (interface{}, bool, string) {
+		return b.FeedsBackend.GetLC(ctx, functionName, req, lc)
+	}, lc)
+	return value.(commons.InternalGetLCResp), ok, errStr
+}
+
+func (b *HedgingFeedsBackend) LMHIS(ctx context.Context, functionName string, req commons.InternalLMHISReq, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
+	//new and old parts of the section have different latency
+	section := fmt.Sprintf("%s:%s:%v", functionName, req.LMHISPart, req.RequestNewPart)
+	value, ok, errStr := b.hedger.Do(ctx, functionName, section, func(ctx context.Context) (interface{}, bool, string) {
+		return b.FeedsBackend.LMHIS(ctx, functionName, req, lc)
+	}, lc)
+	return value.(commons.InternalLMHISResp), ok, errStr
+}
+
+//withHedging wraps backend with hedger if it is enabled by HEDGE_ENABLED
+func withHedging(backend FeedsBackend, config Config) FeedsBackend {
+	if !config.HedgeEnabled {
+		return backend
+	}
+	return NewHedgingFeedsBackend(backend, NewHedger(config.HedgeBudgetPercent, time.Duration(config.HedgeMinDelayMs)*time.Millisecond, config.HedgeMinSamples))
+}
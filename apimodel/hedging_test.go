@@ -0,0 +1,79 @@
+package apimodel
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//the first call hangs until it is canceled, the next ones answer at once
+func slowFirstCall(calls *int32, firstCanceled chan struct{}) func(ctx context.Context) (interface{}, bool, string) {
+	return func(ctx context.Context) (interface{}, bool, string) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			select {
+			case <-ctx.Done():
+				close(firstCanceled)
+				return nil, false, InternalServiceTimeoutError
+			case <-time.After(100 * time.Millisecond):
+				return "slow", true, ""
+			}
+		}
+		return "fast", true, ""
+	}
+}
+
+func TestHedger(t *testing.T) {
+	tests := []struct {
+		name          string
+		budgetPercent int
+		samples       int
+		wantValue     interface{}
+		wantCalls     int32
+	}{
+		{name: "slow call is hedged", budgetPercent: 100, samples: 5, wantValue: "fast", wantCalls: 2},
+		{name: "no hedge without enough samples", budgetPercent: 100, samples: 4, wantValue: "slow", wantCalls: 1},
+		{name: "no hedge without budget", budgetPercent: 0, samples: 5, wantValue: "slow", wantCalls: 1},
+	}
+	for _, each := range tests {
+		t.Run(each.name, func(t *testing.T) {
+			hedger := NewHedger(each.budgetPercent, 10*time.Millisecond, 5)
+			for i := 0; i < each.samples; i++ {
+				hedger.observe("likes", time.Millisecond)
+			}
+			var calls int32
+			firstCanceled := make(chan struct{})
+			value, ok, errStr := hedger.Do(context.Background(), "get-lc-likes", "likes", slowFirstCall(&calls, firstCanceled), nil)
+			if !ok || value != each.wantValue {
+				t.Fatalf("got (%v, %v, %s), want (%v, true)", value, ok, errStr, each.wantValue)
+			}
+			if got := atomic.LoadInt32(&calls); got != each.wantCalls {
+				t.Errorf("fn called %d times, want %d", got, each.wantCalls)
+			}
+			if each.wantCalls == 2 {
+				select {
+				case <-firstCanceled:
+				case <-time.After(time.Second):
+					t.Errorf("slow call was not canceled after the hedge won")
+				}
+			}
+		})
+	}
+}
+
+func TestHedgerReturnsErrorWhenBothCallsFail(t *testing.T) {
+	hedger := NewHedger(100, 5*time.Millisecond, 1)
+	hedger.observe("likes", time.Millisecond)
+	var calls int32
+	value, ok, errStr := hedger.Do(context.Background(), "get-lc-likes", "likes", func(ctx context.Context) (interface{}, bool, string) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil, false, InternalServiceCrashError
+	}, nil)
+	if ok || errStr != InternalServiceCrashError || value != nil {
+		t.Errorf("got (%v, %v, %s), want crash error", value, ok, errStr)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,111 @@
+package apimodel
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+//InstrumentedFeedsBackend wraps every call of the backend into span, counts failed calls and tracks backend load
+type InstrumentedFeedsBackend struct {
+	next FeedsBackend
+}
+
+func NewInstrumentedFeedsBackend(next FeedsBackend) *InstrumentedFeedsBackend {
+	return &InstrumentedFeedsBackend{next: next}
+}
+
+func endInvokeSpan(ctx context.Context, span trace.Span, functionName string, start time.Time, ok bool, errStr string) {
+	//call canceled by the caller (e.g. another section of fan-out failed) is not an error of the function
+	canceled := !ok && ctx.Err() == context.Canceled
+	if !ok && !canceled {
+		Metrics.InternalCallError(functionName)
+	}
+	//a canceled call would be observed as slow and raise the load of healthy backend
+	if !canceled {
+		Polling.Load.Observe(time.Since(start), ok)
+	}
+	EndSpan(span, ok, errStr)
+}
+
+func invokeSpan(ctx context.Context, functionName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("function", functionName))
+	return StartSpan(ctx, "invoke "+functionName, attrs...)
+}
+
+func (b *InstrumentedFeedsBackend) VerifyAccessToken(ctx context.Context, appVersion int, isItAndroid bool, accessToken string, lc *lambdacontext.LambdaContext) (string, bool, string) {
+	start := time.Now()
+	ctx, span := StartSpan(ctx, "verify access token", attribute.String("function", Settings().InternalAuthFunctionName),
+		attribute.Int("appVersion", appVersion), attribute.Bool("isItAndroid", isItAndroid))
+	userId, ok, errStr := b.next.VerifyAccessToken(ctx, appVersion, isItAndroid, accessToken, lc)
+	endInvokeSpan(ctx, span, Settings().InternalAuthFunctionName, start, ok, errStr)
+	return userId, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) GetNewFaces(ctx context.Context, req commons.InternalGetNewFacesReq, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, Settings().GetNewFacesFunctionName)
+	resp, ok, errStr := b.next.GetNewFaces(ctx, req, lc)
+	span.SetAttributes(attribute.Int("profiles", len(resp.NewFaces)))
+	endInvokeSpan(ctx, span, Settings().GetNewFacesFunctionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) Discover(ctx context.Context, req *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, Settings().DiscoverFunctionName)
+	resp, ok, errStr := b.next.Discover(ctx, req, lc)
+	span.SetAttributes(attribute.Int("profiles", len(resp.NewFaces)))
+	endInvokeSpan(ctx, span, Settings().DiscoverFunctionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) GetLC(ctx context.Context, functionName string, req *commons.GetLCRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetLCResp, bool, string) {
+	attrs := make([]attribute.KeyValue, 0)
+	if req.Limit != nil {
+		attrs = append(attrs, attribute.Int("limit", *req.Limit))
+	}
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, functionName, attrs...)
+	resp, ok, errStr := b.next.GetLC(ctx, functionName, req, lc)
+	span.SetAttributes(attribute.Int("profiles", len(resp.Profiles)))
+	endInvokeSpan(ctx, span, functionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) LMM(ctx context.Context, functionName string, req commons.InternalLMMReq, lc *lambdacontext.LambdaContext) (commons.InternalLMMResp, bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, functionName, attribute.Bool("requestNewPart", req.RequestNewPart))
+	resp, ok, errStr := b.next.LMM(ctx, functionName, req, lc)
+	span.SetAttributes(attribute.Int("profiles", len(resp.Profiles)))
+	endInvokeSpan(ctx, span, functionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) LMHIS(ctx context.Context, functionName string, req commons.InternalLMHISReq, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, functionName, attribute.Bool("requestNewPart", req.RequestNewPart), attribute.String("lmhisPart", req.LMHISPart))
+	resp, ok, errStr := b.next.LMHIS(ctx, functionName, req, lc)
+	span.SetAttributes(attribute.Int("profiles", len(resp.Profiles)))
+	endInvokeSpan(ctx, span, functionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) Chat(ctx context.Context, req commons.InternalChatRequest, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, Settings().ChatFunctionName)
+	resp, ok, errStr := b.next.Chat(ctx, req, lc)
+	endInvokeSpan(ctx, span, Settings().ChatFunctionName, start, ok, errStr)
+	return resp, ok, errStr
+}
+
+func (b *InstrumentedFeedsBackend) PrepareNewFaces(ctx context.Context, req commons.InternalPrepareNewFacesReq, lc *lambdacontext.LambdaContext) (bool, string) {
+	start := time.Now()
+	ctx, span := invokeSpan(ctx, Settings().PrepareNewFacesFunctionName)
+	ok, errStr := b.next.PrepareNewFaces(ctx, req, lc)
+	endInvokeSpan(ctx, span, Settings().PrepareNewFacesFunctionName, start, ok, errStr)
+	return ok, errStr
+}
@@ -0,0 +1,164 @@
+package apimodel
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ringoid/commons"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+//LambdaFeedsBackend calls internal functions using synchronous lambda invocation
+type LambdaFeedsBackend struct {
+	client *lambda.Lambda
+}
+
+func NewLambdaFeedsBackend(client *lambda.Lambda) *LambdaFeedsBackend {
+	return &LambdaFeedsBackend{client: client}
+}
+
+type verifyAccessTokenResult struct {
+	userId string
+	ok     bool
+	errStr string
+}
+
+func (b *LambdaFeedsBackend) VerifyAccessToken(ctx context.Context, appVersion int, isItAndroid bool, accessToken string, lc *lambdacontext.LambdaContext) (string, bool, string) {
+	//commons logs the token as it is
+	unmask := MaskSecret(accessToken)
+
+	callCtx, cancel := context.WithTimeout(ctx, InternalCallTimeout(Settings().InternalAuthFunctionName))
+	defer cancel()
+
+	//commons invokes auth without context, so the call can not be canceled, the request just stops waiting for it
+	results := make(chan verifyAccessTokenResult, 1)
+	go func() {
+		userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, accessToken, Settings().InternalAuthFunctionName, b.client, CommonsLogger, lc)
+		results <- verifyAccessTokenResult{userId: userId, ok: ok, errStr: errStr}
+		//messages of the call are redacted before the token is forgotten, the request doesn't wait for it
+		DrainCommonsLogs(lc)
+		unmask()
+	}()
+
+	select {
+	case result := <-results:
+		return result.userId, result.ok, result.errStr
+	case <-callCtx.Done():
+		Anlogger.Errorf(lc, "lambda_backend.go : function [%s] did not verify access token in time : %v", Settings().InternalAuthFunctionName, callCtx.Err())
+		return "", false, internalCallErrorStr(callCtx)
+	}
+}
+
+func (b *LambdaFeedsBackend) GetNewFaces(ctx context.Context, req commons.InternalGetNewFacesReq, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	var response commons.InternalGetNewFacesResp
+	ok, errStr := b.invoke(ctx, Settings().GetNewFacesFunctionName, req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) Discover(ctx context.Context, req *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetNewFacesResp, bool, string) {
+	var response commons.InternalGetNewFacesResp
+	ok, errStr := b.invoke(ctx, Settings().DiscoverFunctionName, *req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) GetLC(ctx context.Context, functionName string, req *commons.GetLCRequest, lc *lambdacontext.LambdaContext) (commons.InternalGetLCResp, bool, string) {
+	var response commons.InternalGetLCResp
+	ok, errStr := b.invoke(ctx, functionName, *req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) LMM(ctx context.Context, functionName string, req commons.InternalLMMReq, lc *lambdacontext.LambdaContext) (commons.InternalLMMResp, bool, string) {
+	var response commons.InternalLMMResp
+	ok, errStr := b.invoke(ctx, functionName, req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) LMHIS(ctx context.Context, functionName string, req commons.InternalLMHISReq, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
+	var response commons.InternalLMHISResp
+	ok, errStr := b.invoke(ctx, functionName, req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) Chat(ctx context.Context, req commons.InternalChatRequest, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, bool, string) {
+	var response commons.InternalChatResponse
+	ok, errStr := b.invoke(ctx, Settings().ChatFunctionName, req.UserId, req, &response, lc)
+	return response, ok, errStr
+}
+
+func (b *LambdaFeedsBackend) PrepareNewFaces(ctx context.Context, req commons.InternalPrepareNewFacesReq, lc *lambdacontext.LambdaContext) (bool, string) {
+	jsonBody, err := marshalWithRequestId(req, lc)
+	if err != nil {
+		Anlogger.Errorf(lc, "lambda_backend.go : error marshaling req %v into json for userId [%s] : %v", req, req.UserId, err)
+		return false, commons.InternalServerError
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, InternalCallTimeout(Settings().PrepareNewFacesFunctionName))
+	defer cancel()
+
+	resp, err := b.client.InvokeWithContext(callCtx, &lambda.InvokeInput{FunctionName: aws.String(Settings().PrepareNewFacesFunctionName), InvocationType: aws.String("Event"), Payload: jsonBody})
+	if err != nil {
+		Anlogger.Errorf(lc, "lambda_backend.go : error invoke function [%s] with body %s for userId [%s] : %v", Settings().PrepareNewFacesFunctionName, jsonBody, req.UserId, err)
+		return false, internalCallErrorStr(callCtx)
+	}
+
+	if *resp.StatusCode != 202 && *resp.StatusCode != 200 {
+		Anlogger.Errorf(lc, "lambda_backend.go : status code = %d, response body %s for request %s, for userId [%s] (function name %s)",
+			*resp.StatusCode, string(resp.Payload), jsonBody, req.UserId, Settings().PrepareNewFacesFunctionName)
+		return false, commons.InternalServerError
+	}
+	return true, ""
+}
+
+//ok and error string, retryable failures are retried and every function has own circuit breaker
+func (b *LambdaFeedsBackend) invoke(ctx context.Context, functionName, userId string, req interface{}, response interface{}, lc *lambdacontext.LambdaContext) (bool, string) {
+	jsonBody, err := marshalWithRequestId(req, lc)
+	if err != nil {
+		Anlogger.Errorf(lc, "lambda_backend.go : error marshaling req %v into json for userId [%s] (function name %s) : %v",
+			req, userId, functionName, err)
+		return false, commons.InternalServerError
+	}
+
+	return Resilience.Call(ctx, functionName, userId, func(ctx context.Context) (bool, bool, bool, string) {
+		return b.invokeOnce(ctx, functionName, userId, jsonBody, response, lc)
+	}, lc)
+}
+
+//ok, is failure retryable, is failure handled by the function and error string
+func (b *LambdaFeedsBackend) invokeOnce(ctx context.Context, functionName, userId string, jsonBody []byte, response interface{}, lc *lambdacontext.LambdaContext) (bool, bool, bool, string) {
+	callCtx, cancel := context.WithTimeout(ctx, InternalCallTimeout(functionName))
+	defer cancel()
+
+	resp, err := b.client.InvokeWithContext(callCtx, &lambda.InvokeInput{FunctionName: aws.String(functionName), Payload: jsonBody})
+	if err != nil {
+		Anlogger.Errorf(lc, "lambda_backend.go : error invoke function [%s] with body %s for userId [%s] : %v",
+			functionName, jsonBody, userId, err)
+		//sdk already retried the throttled call commons.MaxRetries times without jitter
+		return false, callCtx.Err() == nil && request.IsErrorThrottle(err), false, internalCallErrorStr(callCtx)
+	}
+
+	if *resp.StatusCode != 200 {
+		Anlogger.Errorf(lc, "lambda_backend.go : status code = %d, response body %s for request %s, for userId [%s] (function name %s)",
+			*resp.StatusCode, string(resp.Payload), jsonBody, userId, functionName)
+		return false, false, true, commons.InternalServerError
+	}
+
+	//panic or timeout of the function is status 200 with error payload
+	if resp.FunctionError != nil {
+		functionError := ParseFunctionError(*resp.FunctionError, resp.Payload)
+		Anlogger.WithFields(Fields{"function": functionName, "userId": userId, "functionErrorKind": functionError.Kind, "functionErrorType": functionError.Type}).
+			Errorf(lc, "lambda_backend.go : function [%s] failed with [%s] error [%s] of type [%s] : %s, request %s, for userId [%s]",
+				functionName, functionError.Header, functionError.Kind, functionError.Type, functionError.Message, jsonBody, userId)
+		Metrics.InternalFunctionError(functionName, functionError.Kind)
+		return false, functionError.Retryable(), functionError.Kind == FunctionErrorHandled, functionError.ClientErrorStr()
+	}
+
+	err = json.Unmarshal(resp.Payload, response)
+	if err != nil {
+		Anlogger.Errorf(lc, "lambda_backend.go : error unmarshaling response %s into json for userId [%s] (function name %s) : %v",
+			string(resp.Payload), userId, functionName, err)
+		return false, false, true, commons.InternalServerError
+	}
+	return true, false, false, ""
+}
@@ -0,0 +1,193 @@
+package apimodel
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultLocale = "en"
+
+	pluralOne   = "one"
+	pluralFew   = "few"
+	pluralMany  = "many"
+	pluralOther = "other"
+)
+
+//go:embed locales/*.json
+var embeddedLocales embed.FS
+
+//locales which don't have own catalog but are close enough to another one,
+//ua is a country code which old clients send instead of uk
+var localeAliases = map[string]string{
+	"ua": "uk",
+	"be": "ru",
+}
+
+//PluralMessage is a text per CLDR plural category, plain string in json means the same text for all categories
+type PluralMessage map[string]string
+
+func (m *PluralMessage) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = PluralMessage{pluralOther: text}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	*m = PluralMessage(forms)
+	return nil
+}
+
+//Catalog keeps messages per language, every lookup goes through the fallback chain
+//(uk-ua -> uk -> DefaultLocale) until the message is found
+type Catalog struct {
+	mu       sync.RWMutex
+	messages map[string]map[string]PluralMessage
+}
+
+//Localization is used by all text transformations, replace it to ship another set of texts
+var Localization = MustLoadCatalog(embeddedLocales, "locales")
+
+func NewCatalog() *Catalog {
+	return &Catalog{messages: make(map[string]map[string]PluralMessage)}
+}
+
+//LoadCatalog reads <locale>.json files from dir
+func LoadCatalog(fsys fs.FS, dir string) (*Catalog, error) {
+	catalog := NewCatalog()
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]PluralMessage
+		err = json.Unmarshal(data, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing locale file [%s] : %v", file, err)
+		}
+		catalog.AddLocale(strings.TrimSuffix(path.Base(file), ".json"), messages)
+	}
+	return catalog, nil
+}
+
+func MustLoadCatalog(fsys fs.FS, dir string) *Catalog {
+	catalog, err := LoadCatalog(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}
+
+//AddLocale adds messages to the locale, existing messages with the same keys are replaced
+func (c *Catalog) AddLocale(locale string, messages map[string]PluralMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locale = normalizeLocale(locale)
+	if _, ok := c.messages[locale]; !ok {
+		c.messages[locale] = make(map[string]PluralMessage)
+	}
+	for key, msg := range messages {
+		c.messages[locale][key] = msg
+	}
+}
+
+//Text returns message for the key with {n} replaced by n, key itself if there is no such message at all
+func (c *Catalog) Text(locale, key string, n int64) string {
+	text, ok := c.lookup(locale, key, n)
+	if !ok {
+		return key
+	}
+	return strings.Replace(text, "{n}", strconv.FormatInt(n, 10), -1)
+}
+
+//TextRange returns message for the key with {from} and {to} replaced, plural form is selected by to
+func (c *Catalog) TextRange(locale, key string, from, to int64) string {
+	text, ok := c.lookup(locale, key, to)
+	if !ok {
+		return key
+	}
+	text = strings.Replace(text, "{from}", strconv.FormatInt(from, 10), -1)
+	return strings.Replace(text, "{to}", strconv.FormatInt(to, 10), -1)
+}
+
+func (c *Catalog) lookup(locale, key string, n int64) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, each := range fallbackChain(locale) {
+		msg, ok := c.messages[each][key]
+		if !ok {
+			continue
+		}
+		text, ok := msg[pluralCategory(each, n)]
+		if !ok {
+			text, ok = msg[pluralOther]
+		}
+		if ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(locale)), "_", "-", -1)
+}
+
+func fallbackChain(locale string) []string {
+	locale = normalizeLocale(locale)
+	chain := make([]string, 0, 4)
+	if len(locale) != 0 {
+		chain = append(chain, locale)
+		lang := strings.Split(locale, "-")[0]
+		if lang != locale {
+			chain = append(chain, lang)
+		}
+		if alias, ok := localeAliases[lang]; ok {
+			chain = append(chain, alias)
+		}
+	}
+	return append(chain, DefaultLocale)
+}
+
+//CLDR plural category of integer n
+func pluralCategory(locale string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	switch strings.Split(locale, "-")[0] {
+	case "ru", "uk", "be":
+		mod10, mod100 := n%10, n%100
+		if mod10 == 1 && mod100 != 11 {
+			return pluralOne
+		}
+		if mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14) {
+			return pluralFew
+		}
+		return pluralMany
+	case "fr", "pt":
+		if n == 0 || n == 1 {
+			return pluralOne
+		}
+		return pluralOther
+	case "ja", "ko", "zh", "vi", "th":
+		return pluralOther
+	default:
+		if n == 1 {
+			return pluralOne
+		}
+		return pluralOther
+	}
+}
@@ -0,0 +1,82 @@
+package apimodel
+
+import "testing"
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		locale string
+		n      int64
+		want   string
+	}{
+		{locale: "en", n: 1, want: pluralOne},
+		{locale: "en", n: 0, want: pluralOther},
+		{locale: "en", n: 21, want: pluralOther},
+		{locale: "ru", n: 1, want: pluralOne},
+		{locale: "ru", n: 21, want: pluralOne},
+		{locale: "ru", n: 11, want: pluralMany},
+		{locale: "ru", n: 3, want: pluralFew},
+		{locale: "ru", n: 24, want: pluralFew},
+		{locale: "ru", n: 13, want: pluralMany},
+		{locale: "ru", n: 5, want: pluralMany},
+		{locale: "ru", n: 0, want: pluralMany},
+		{locale: "uk-ua", n: 112, want: pluralMany},
+		{locale: "uk", n: 102, want: pluralFew},
+		{locale: "fr", n: 0, want: pluralOne},
+		{locale: "fr", n: 2, want: pluralOther},
+		{locale: "ja", n: 1, want: pluralOther},
+		{locale: "en", n: -1, want: pluralOne},
+	}
+	for _, each := range tests {
+		if got := pluralCategory(each.locale, each.n); got != each.want {
+			t.Errorf("pluralCategory(%q, %d) = %q, want %q", each.locale, each.n, got, each.want)
+		}
+	}
+}
+
+func TestCatalogText(t *testing.T) {
+	catalog := NewCatalog()
+	catalog.AddLocale("en", map[string]PluralMessage{
+		"minutesAgo": {pluralOther: "{n}m ago"},
+		"onlyEn":     {pluralOther: "english"},
+	})
+	catalog.AddLocale("ru", map[string]PluralMessage{
+		"minutesAgo": {pluralOne: "{n} минуту назад", pluralFew: "{n} минуты назад", pluralMany: "{n} минут назад"},
+		"noForms":    {pluralOne: "{n} один"},
+	})
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		n      int64
+		want   string
+	}{
+		{name: "one", locale: "ru", key: "minutesAgo", n: 21, want: "21 минуту назад"},
+		{name: "few", locale: "ru", key: "minutesAgo", n: 2, want: "2 минуты назад"},
+		{name: "many", locale: "ru", key: "minutesAgo", n: 12, want: "12 минут назад"},
+		{name: "region falls back to language", locale: "ru_RU", key: "minutesAgo", n: 5, want: "5 минут назад"},
+		{name: "alias", locale: "be", key: "minutesAgo", n: 1, want: "1 минуту назад"},
+		{name: "missing key falls back to default locale", locale: "ru", key: "onlyEn", n: 1, want: "english"},
+		{name: "missing plural form without other", locale: "ru", key: "noForms", n: 5, want: "noForms"},
+		{name: "unknown locale", locale: "xx", key: "minutesAgo", n: 3, want: "3m ago"},
+		{name: "empty locale", locale: "", key: "minutesAgo", n: 3, want: "3m ago"},
+		{name: "unknown key", locale: "en", key: "nothing", n: 3, want: "nothing"},
+	}
+	for _, each := range tests {
+		t.Run(each.name, func(t *testing.T) {
+			if got := catalog.Text(each.locale, each.key, each.n); got != each.want {
+				t.Errorf("Text(%q, %q, %d) = %q, want %q", each.locale, each.key, each.n, got, each.want)
+			}
+		})
+	}
+}
+
+//every locale file has the same keys as the default one
+func TestEmbeddedLocalesAreComplete(t *testing.T) {
+	for locale, messages := range Localization.messages {
+		for key := range Localization.messages[DefaultLocale] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("locale [%s] has no message [%s]", locale, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package apimodel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/ringoid/commons"
+	"math"
+)
+
+const (
+	//exact distance, old behaviour
+	LocationPrivacyNone = "none"
+	//both points are snapped to the center of the grid cell
+	LocationPrivacyGrid = "grid"
+	//the profile is moved by deterministic offset of the profile, so repeated requests don't average it out
+	LocationPrivacyJitter = "jitter"
+
+	defaultPrivacyGridMeters   = 1000
+	defaultPrivacyJitterMeters = 1000
+
+	metersInLatDegree = 111320
+)
+
+//bucket borders in distance units (km or mi)
+var distanceBuckets = []int64{2, 5, 10, 20, 50, 100}
+
+type LocationPrivacy struct {
+	Mode         string
+	GridMeters   float64
+	JitterMeters float64
+	//secret for jitter, without it the offset can be recalculated by anyone who knows the userId
+	Salt []byte
+}
+
+//DistancePrivacy is applied to every distance text
+var DistancePrivacy = LocationPrivacy{
+	Mode:         LocationPrivacyGrid,
+	GridMeters:   defaultPrivacyGridMeters,
+	JitterMeters: defaultPrivacyJitterMeters,
+}
+
+//InitLocationPrivacy sets DistancePrivacy from the config
+func InitLocationPrivacy(config Config) {
+	DistancePrivacy = LocationPrivacy{
+		Mode:         config.LocationPrivacyMode,
+		GridMeters:   config.LocationPrivacyGridMeters,
+		JitterMeters: config.LocationPrivacyJitterMeters,
+		Salt:         []byte(config.LocationPrivacySalt),
+	}
+}
+
+//DistanceText returns distance text between viewer (source coordinates) and the profile
+func (p LocationPrivacy) DistanceText(internal commons.InternalProfiles, unit DistanceUnit) string {
+	switch p.Mode {
+	case LocationPrivacyGrid:
+		sourceLat, sourceLon := p.snap(internal.SourceLat, internal.SourceLon)
+		lat, lon := p.snap(internal.Lat, internal.Lon)
+		return BucketedDistanceText(Distance(Point(lat, lon), Point(sourceLat, sourceLon)), unit, internal.SourceLocale)
+	case LocationPrivacyJitter:
+		lat, lon := p.jitter(internal.UserId, internal.Lat, internal.Lon)
+		return BucketedDistanceText(Distance(Point(lat, lon), Point(internal.SourceLat, internal.SourceLon)), unit, internal.SourceLocale)
+	default:
+		distance := Distance(Point(internal.Lat, internal.Lon), Point(internal.SourceLat, internal.SourceLon))
+		return FormatDistance(distance, unit, internal.SourceLocale)
+	}
+}
+
+//center of the grid cell which contains the point
+func (p LocationPrivacy) snap(lat, lon float64) (float64, float64) {
+	latStep := p.GridMeters / metersInLatDegree
+	lat = (math.Floor(lat/latStep) + 0.5) * latStep
+	//cell width in degrees grows to the poles, keep it finite
+	cos := math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	lonStep := p.GridMeters / (metersInLatDegree * cos)
+	lon = (math.Floor(lon/lonStep) + 0.5) * lonStep
+	return lat, lon
+}
+
+//jitter moves the point of the user by the offset of the user, between a half of JitterMeters and JitterMeters
+//in any direction. Noise added to the distance would keep the real point in the center of the circle found by
+//trilateration. Every viewer sees the same moved point, so points found from several accounts don't surround
+//the real one, and the offset never changes, so points found at different times don't either.
+func (p LocationPrivacy) jitter(userId string, lat, lon float64) (float64, float64) {
+	mac := hmac.New(sha256.New, p.Salt)
+	mac.Write([]byte(userId))
+	sum := mac.Sum(nil)
+	angle := 2 * math.Pi * hashFraction(sum[:8])
+	radius := p.JitterMeters * (0.5 + 0.5*hashFraction(sum[8:16]))
+	cos := math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	return lat + radius*math.Cos(angle)/metersInLatDegree, lon + radius*math.Sin(angle)/(metersInLatDegree*cos)
+}
+
+//value in [0, 1) from 8 bytes of the hash
+func hashFraction(b []byte) float64 {
+	return float64(binary.BigEndian.Uint64(b)>>11) / (1 << 53)
+}
+
+//BucketedDistanceText returns range text like "2-5 km" instead of the exact distance
+func BucketedDistanceText(meters float64, unit DistanceUnit, locale string) string {
+	if unit == DistanceUnitAuto {
+		unit = DistanceUnitForLocale(locale)
+	}
+	value := meters / 1000
+	lessThanKey, rangeKey, moreThanKey := "distance.lessThanKm", "distance.kmRange", "distance.moreThanKm"
+	if unit == DistanceUnitMiles {
+		value = meters / metersInMile
+		lessThanKey, rangeKey, moreThanKey = "distance.lessThanMi", "distance.miRange", "distance.moreThanMi"
+	}
+
+	if value < float64(distanceBuckets[0]) {
+		return Localization.Text(locale, lessThanKey, distanceBuckets[0])
+	}
+	for i := 1; i < len(distanceBuckets); i++ {
+		if value < float64(distanceBuckets[i]) {
+			return Localization.TextRange(locale, rangeKey, distanceBuckets[i-1], distanceBuckets[i])
+		}
+	}
+	return Localization.Text(locale, moreThanKey, distanceBuckets[len(distanceBuckets)-1])
+}
@@ -0,0 +1,119 @@
+package apimodel
+
+import (
+	"github.com/ringoid/commons"
+	"math"
+	"testing"
+)
+
+const testLat, testLon = 52.52, 13.405
+
+//profile at test location seen by the viewer who is east and north meters from it
+func profileSeenFrom(east, north float64) commons.InternalProfiles {
+	cos := math.Cos(testLat * math.Pi / 180)
+	return commons.InternalProfiles{UserId: "victim", Lat: testLat, Lon: testLon, SourceLocale: "en",
+		SourceLat: testLat + north/metersInLatDegree, SourceLon: testLon + east/(metersInLatDegree*cos)}
+}
+
+func TestBucketedDistanceText(t *testing.T) {
+	tests := []struct {
+		meters float64
+		unit   DistanceUnit
+		want   string
+	}{
+		{meters: 300, unit: DistanceUnitKilometers, want: "less than 2 km"},
+		{meters: 2000, unit: DistanceUnitKilometers, want: "2-5 km"},
+		{meters: 49999, unit: DistanceUnitKilometers, want: "20-50 km"},
+		{meters: 100000, unit: DistanceUnitKilometers, want: "more than 100 km"},
+		{meters: 3 * metersInMile, unit: DistanceUnitMiles, want: "2-5 mi"},
+	}
+	for _, each := range tests {
+		if got := BucketedDistanceText(each.meters, each.unit, "en"); got != each.want {
+			t.Errorf("BucketedDistanceText(%v, %q) = %q, want %q", each.meters, each.unit, got, each.want)
+		}
+	}
+}
+
+func TestGridPrivacySnapsBothPoints(t *testing.T) {
+	privacy := LocationPrivacy{Mode: LocationPrivacyGrid, GridMeters: 1000}
+	lat, lon := privacy.snap(testLat, testLon)
+	if d := Distance(Point(lat, lon), Point(testLat, testLon)); d > 1000*math.Sqrt2/2 {
+		t.Errorf("snapped point is %v m away, more than a half of the cell diagonal", d)
+	}
+	if again, _ := privacy.snap(lat, lon); again != lat {
+		t.Errorf("center of the cell snapped to another cell")
+	}
+}
+
+func TestJitterDependsOnUserAndSalt(t *testing.T) {
+	privacy := LocationPrivacy{Mode: LocationPrivacyJitter, JitterMeters: 1000, Salt: []byte("salt")}
+	lat1, lon1 := privacy.jitter("a", testLat, testLon)
+	if lat2, lon2 := privacy.jitter("a", testLat, testLon); lat1 != lat2 || lon1 != lon2 {
+		t.Errorf("jitter of the same user is (%v, %v) and (%v, %v)", lat1, lon1, lat2, lon2)
+	}
+	if lat2, lon2 := privacy.jitter("b", testLat, testLon); lat1 == lat2 && lon1 == lon2 {
+		t.Errorf("jitter does not depend on the user")
+	}
+	other := LocationPrivacy{Mode: LocationPrivacyJitter, JitterMeters: 1000, Salt: []byte("other salt")}
+	if lat3, lon3 := other.jitter("a", testLat, testLon); lat3 == lat1 && lon3 == lon1 {
+		t.Errorf("jitter does not depend on the salt")
+	}
+}
+
+//trilaterate walks from spoofed positions of the viewer to the edge of the first bucket in three directions
+//starting from the angle and returns the center of the circle through the edge points
+func trilaterate(viewerId string, startAngle float64) (float64, float64) {
+	nearest := Localization.Text("en", "distance.lessThanKm", distanceBuckets[0])
+	edges := make([][2]float64, 0, 3)
+	for _, angle := range []float64{startAngle, startAngle + 2*math.Pi/3, startAngle + 4*math.Pi/3} {
+		east, north := math.Sin(angle), math.Cos(angle)
+		internal := profileSeenFrom(0, 0)
+		internal.LocationExist = true
+		low, high := 0.0, 4000.0
+		for high-low > 0.01 {
+			middle := (low + high) / 2
+			seen := profileSeenFrom(middle*east, middle*north)
+			internal.SourceLat, internal.SourceLon = seen.SourceLat, seen.SourceLon
+			if TransformDistanceInDistanceText(viewerId, internal, DistanceUnitKilometers, nil) == nearest {
+				low = middle
+			} else {
+				high = middle
+			}
+		}
+		edges = append(edges, [2]float64{low * east, low * north})
+	}
+	return circumcenter(edges[0], edges[1], edges[2])
+}
+
+//every account of the attacker finds a point, the average of the points should not be the real location
+func TestJitterMovesTrilaterationCenter(t *testing.T) {
+	const jitterMeters = 1000
+	saved := DistancePrivacy
+	defer func() { DistancePrivacy = saved }()
+	DistancePrivacy = LocationPrivacy{Mode: LocationPrivacyJitter, JitterMeters: jitterMeters, Salt: []byte("salt")}
+
+	viewerIds := []string{"attacker1", "attacker2", "attacker3", "attacker4", "attacker5", "attacker6", "attacker7", "attacker8"}
+	var sumX, sumY float64
+	for i, viewerId := range viewerIds {
+		x, y := trilaterate(viewerId, float64(i)*0.4)
+		if off := math.Hypot(x, y); off < jitterMeters/2-20 || off > jitterMeters+20 {
+			t.Errorf("viewer [%s] found the profile %v m away from the real location, want between %v and %v",
+				viewerId, off, jitterMeters/2, jitterMeters)
+		}
+		sumX += x
+		sumY += y
+	}
+	x, y := sumX/float64(len(viewerIds)), sumY/float64(len(viewerIds))
+	if off := math.Hypot(x, y); off < jitterMeters/2-20 {
+		t.Errorf("average of points found by %d accounts is %v m away from the real location, want at least %v",
+			len(viewerIds), off, jitterMeters/2)
+	}
+}
+
+func circumcenter(a, b, c [2]float64) (float64, float64) {
+	d := 2 * (a[0]*(b[1]-c[1]) + b[0]*(c[1]-a[1]) + c[0]*(a[1]-b[1]))
+	aa, bb, cc := a[0]*a[0]+a[1]*a[1], b[0]*b[0]+b[1]*b[1], c[0]*c[0]+c[1]*c[1]
+	x := (aa*(b[1]-c[1]) + bb*(c[1]-a[1]) + cc*(a[1]-b[1])) / d
+	y := (aa*(c[0]-b[0]) + bb*(a[0]-c[0]) + cc*(b[0]-a[0])) / d
+	return x, y
+}
@@ -0,0 +1,156 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	LogBackendPapertrail = "papertrail"
+	LogBackendJSON       = "json"
+
+	levelDebug = "debug"
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+	levelFatal = "fatal"
+)
+
+//Logger is implemented by commons.Logger and JSONLogger
+type Logger interface {
+	Debugf(lc *lambdacontext.LambdaContext, s string, v ...interface{})
+	Infof(lc *lambdacontext.LambdaContext, s string, v ...interface{})
+	Warnf(lc *lambdacontext.LambdaContext, s string, v ...interface{})
+	Errorf(lc *lambdacontext.LambdaContext, s string, v ...interface{})
+	Fatalf(lc *lambdacontext.LambdaContext, s string, v ...interface{})
+	AwsLog(args ...interface{})
+}
+
+//Fields are added to structured log records, plain text loggers ignore them
+type Fields map[string]interface{}
+
+//fieldLogger is a Logger which can write fields as separate keys
+type fieldLogger interface {
+	Logf(level string, lc *lambdacontext.LambdaContext, fields Fields, s string, v ...interface{})
+}
+
+//JSONLogger writes one json object per line, e.g. to stdout which lambda sends to CloudWatch Logs
+type JSONLogger struct {
+	mu   sync.Mutex
+	out  io.Writer
+	name string
+}
+
+func NewJSONLogger(out io.Writer, name string) *JSONLogger {
+	return &JSONLogger{out: out, name: name}
+}
+
+func (l *JSONLogger) Logf(level string, lc *lambdacontext.LambdaContext, fields Fields, s string, v ...interface{}) {
+	record := make(map[string]interface{}, len(fields)+5)
+	for key, value := range fields {
+		record[key] = value
+	}
+	record["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	record["level"] = level
+	record["logger"] = l.name
+	record["message"] = fmt.Sprintf(s, v...)
+	if lc != nil {
+		if len(lc.AwsRequestID) != 0 {
+			record["awsRequestId"] = lc.AwsRequestID
+		}
+		if requestId := RequestId(lc); len(requestId) != 0 {
+			record[RequestIdKey] = requestId
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"level": levelError, "logger": l.name, "message": fmt.Sprintf("error marshaling log record : %v", err)})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(data, '\n'))
+}
+
+func (l *JSONLogger) Debugf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.Logf(levelDebug, lc, nil, s, v...)
+}
+
+func (l *JSONLogger) Infof(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.Logf(levelInfo, lc, nil, s, v...)
+}
+
+func (l *JSONLogger) Warnf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.Logf(levelWarn, lc, nil, s, v...)
+}
+
+func (l *JSONLogger) Errorf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.Logf(levelError, lc, nil, s, v...)
+}
+
+func (l *JSONLogger) Fatalf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.Logf(levelFatal, lc, nil, s, v...)
+	os.Exit(1)
+}
+
+func (l *JSONLogger) AwsLog(args ...interface{}) {
+	l.Logf(levelDebug, nil, nil, "%s", fmt.Sprint(args...))
+}
+
+//commonsLogBridge is the bridge of CommonsLogger, nil until loggers are initialized
+var commonsLogBridge *CommonsBridge
+
+//DrainCommonsLogs waits until messages which commons functions have logged so far are written,
+//handlers call it at the end of the request, lambda can freeze the container right after the response
+func DrainCommonsLogs(lc *lambdacontext.LambdaContext) {
+	if commonsLogBridge == nil {
+		return
+	}
+	if !commonsLogBridge.Drain(commonsBridgeDrainTimeout) {
+		Anlogger.Warnf(lc, "logger.go : commons logger messages were not written in %v", commonsBridgeDrainTimeout)
+	}
+}
+
+//newLoggers returns logger for commons functions and redacting logger of the backend selected by LOG_BACKEND,
+//commons logger writes to the same backend through CommonsBridge
+func newLoggers(config Config, lambdaName string) (*commons.Logger, *RedactingLogger, error) {
+	name := fmt.Sprintf("%s-%s", config.Env, lambdaName)
+	backend, err := newBackendLogger(config, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger := NewRedactingLogger(backend)
+	bridge, err := NewCommonsBridge(name, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	commonsLogger, err := commons.New(bridge.Address(), name, IsDebugLogEnabled)
+	if err != nil {
+		bridge.Close()
+		return nil, nil, err
+	}
+	if commonsLogBridge != nil {
+		commonsLogBridge.Close()
+	}
+	commonsLogBridge = bridge
+	return commonsLogger, logger, nil
+}
+
+func newBackendLogger(config Config, name string) (Logger, error) {
+	if config.LogBackend != LogBackendJSON {
+		return commons.New(config.PapertrailLogAddress, name, IsDebugLogEnabled)
+	}
+	if len(config.LogFile) == 0 {
+		return NewJSONLogger(os.Stdout, name), nil
+	}
+	file, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file [%s] : %v", config.LogFile, err)
+	}
+	return NewJSONLogger(file, name), nil
+}
@@ -0,0 +1,13 @@
+package apimodel
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//policies log through Anlogger, tests don't need the output
+func TestMain(m *testing.M) {
+	Anlogger = NewRedactingLogger(NewJSONLogger(ioutil.Discard, "feeds-test"))
+	os.Exit(m.Run())
+}
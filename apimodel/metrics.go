@@ -0,0 +1,310 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ringoid/commons"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MetricsBackendNone = "none"
+	MetricsBackendEMF  = "emf"
+
+	LatencyMetricName           = "Latency"
+	InternalCallErrorMetricName = "InternalCallErrors"
+	InternalCallRetryMetricName = "InternalCallRetries"
+	//1 when the circuit is open, 0.5 when half-open and 0 when closed
+	CircuitBreakerStateMetricName     = "CircuitBreakerState"
+	CircuitBreakerRejectionMetricName = "CircuitBreakerRejections"
+	HedgedCallMetricName              = "HedgedCalls"
+	HedgeWinMetricName                = "HedgeWins"
+	//by kind of function error
+	InternalFunctionTimeoutMetricName = "InternalFunctionTimeouts"
+	InternalFunctionPanicMetricName   = "InternalFunctionPanics"
+	InternalFunctionHandledMetricName = "InternalFunctionHandledErrors"
+
+	metricUnitMilliseconds = "Milliseconds"
+	metricUnitCount        = "Count"
+	metricUnitNone         = "None"
+
+	endpointDimension = "Endpoint"
+	functionDimension = "Function"
+
+	//cloudwatch accepts up to 100 values of one metric in one record
+	emfMaxValues = 100
+	//records are dropped if writer is behind, handlers never wait for metrics
+	emfQueueSize = 1024
+	//lambda can be frozen right after the response, so handler waits a bit for pending records
+	emfFlushTimeout = 200 * time.Millisecond
+	//long living processes (local server) don't keep records forever
+	emfFlushInterval = 10 * time.Second
+)
+
+//MetricsRecorder never blocks the caller and never fails the request
+type MetricsRecorder interface {
+	//latency histogram of the endpoint
+	Latency(endpoint string, duration time.Duration)
+	//how many profiles were returned in the section of the endpoint
+	ProfilesReturned(endpoint, section string, count int)
+	InternalCallError(functionName string)
+	InternalCallRetry(functionName string)
+	//written when circuit breaker of the function changes state
+	CircuitBreakerState(functionName, state string)
+	//call was not made because circuit breaker of the function is open
+	CircuitBreakerRejection(functionName string)
+	//duplicate call was made because the first one was slow, hedgeWon when duplicate returned first
+	HedgedCall(functionName string, hedgeWon bool)
+	//function returned FunctionError of the kind (FunctionErrorTimeout, FunctionErrorPanic or FunctionErrorHandled)
+	InternalFunctionError(functionName, kind string)
+	//Flush writes pending records, called at the end of every request
+	Flush()
+}
+
+var Metrics MetricsRecorder = NoopMetrics{}
+
+//InitMetrics sets Metrics selected by METRICS_BACKEND
+func InitMetrics(config Config, out io.Writer) {
+	if config.MetricsBackend != MetricsBackendEMF {
+		Metrics = NoopMetrics{}
+		return
+	}
+	Metrics = NewEMFMetrics(config.BaseCloudWatchNamespace, out)
+}
+
+//FinishRequestMetrics records latency of the endpoint and flushes all metrics of the request
+func FinishRequestMetrics(endpoint string, startTime int64) {
+	Metrics.Latency(endpoint, time.Duration(commons.UnixTimeInMillis()-startTime)*time.Millisecond)
+	Metrics.Flush()
+}
+
+type NoopMetrics struct {
+}
+
+func (NoopMetrics) Latency(endpoint string, duration time.Duration) {
+}
+
+func (NoopMetrics) ProfilesReturned(endpoint, section string, count int) {
+}
+
+func (NoopMetrics) InternalCallError(functionName string) {
+}
+
+func (NoopMetrics) InternalCallRetry(functionName string) {
+}
+
+func (NoopMetrics) CircuitBreakerState(functionName, state string) {
+}
+
+func (NoopMetrics) CircuitBreakerRejection(functionName string) {
+}
+
+func (NoopMetrics) HedgedCall(functionName string, hedgeWon bool) {
+}
+
+func (NoopMetrics) InternalFunctionError(functionName, kind string) {
+}
+
+func (NoopMetrics) Flush() {
+}
+
+//profilesMetricName returns configured metric name of the section, e.g. LikesYouProfilesReturn
+func profilesMetricName(section string) string {
+	name := ""
+	switch section {
+	case NewFacesSection:
+		name = Settings().NewFaceProfilesReturnMetricName
+	case LikesYouSection:
+		name = Settings().LikesYouProfilesReturnMetricName
+	case MatchesSection:
+		name = Settings().MatchProfilesReturnMetricName
+	case MessagesSection:
+		name = Settings().MessageProfilesReturnMetricName
+	}
+	if len(name) == 0 {
+		name = strings.ToUpper(section[:1]) + section[1:] + "ProfilesReturn"
+	}
+	return name
+}
+
+type metricKey struct {
+	name      string
+	unit      string
+	dimension string
+	value     string
+}
+
+type metricValue struct {
+	key   metricKey
+	value float64
+}
+
+//EMFMetrics writes records in CloudWatch Embedded Metric Format, lambda sends stdout to CloudWatch Logs
+//which extracts metrics from them, so there are no PutMetricData calls. Values are collected by background
+//goroutine and written as one record per metric and dimension on Flush.
+type EMFMetrics struct {
+	namespace string
+	out       io.Writer
+	values    chan metricValue
+	flushes   chan chan struct{}
+	dropped   int64
+}
+
+func NewEMFMetrics(namespace string, out io.Writer) *EMFMetrics {
+	m := &EMFMetrics{
+		namespace: namespace,
+		out:       out,
+		values:    make(chan metricValue, emfQueueSize),
+		flushes:   make(chan chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+func (m *EMFMetrics) Latency(endpoint string, duration time.Duration) {
+	m.put(metricKey{LatencyMetricName, metricUnitMilliseconds, endpointDimension, endpoint}, float64(duration)/float64(time.Millisecond))
+}
+
+func (m *EMFMetrics) ProfilesReturned(endpoint, section string, count int) {
+	m.put(metricKey{profilesMetricName(section), metricUnitCount, endpointDimension, endpoint}, float64(count))
+}
+
+func (m *EMFMetrics) InternalCallError(functionName string) {
+	m.put(metricKey{InternalCallErrorMetricName, metricUnitCount, functionDimension, functionName}, 1)
+}
+
+func (m *EMFMetrics) InternalCallRetry(functionName string) {
+	m.put(metricKey{InternalCallRetryMetricName, metricUnitCount, functionDimension, functionName}, 1)
+}
+
+func (m *EMFMetrics) CircuitBreakerState(functionName, state string) {
+	value := 0.0
+	switch state {
+	case CircuitOpen:
+		value = 1
+	case CircuitHalfOpen:
+		value = 0.5
+	}
+	m.put(metricKey{CircuitBreakerStateMetricName, metricUnitNone, functionDimension, functionName}, value)
+}
+
+func (m *EMFMetrics) CircuitBreakerRejection(functionName string) {
+	m.put(metricKey{CircuitBreakerRejectionMetricName, metricUnitCount, functionDimension, functionName}, 1)
+}
+
+func (m *EMFMetrics) HedgedCall(functionName string, hedgeWon bool) {
+	m.put(metricKey{HedgedCallMetricName, metricUnitCount, functionDimension, functionName}, 1)
+	won := 0.0
+	if hedgeWon {
+		won = 1
+	}
+	m.put(metricKey{HedgeWinMetricName, metricUnitCount, functionDimension, functionName}, won)
+}
+
+func (m *EMFMetrics) InternalFunctionError(functionName, kind string) {
+	name := InternalFunctionHandledMetricName
+	switch kind {
+	case FunctionErrorTimeout:
+		name = InternalFunctionTimeoutMetricName
+	case FunctionErrorPanic:
+		name = InternalFunctionPanicMetricName
+	}
+	m.put(metricKey{name, metricUnitCount, functionDimension, functionName}, 1)
+}
+
+func (m *EMFMetrics) Flush() {
+	done := make(chan struct{})
+	select {
+	case m.flushes <- done:
+	case <-time.After(emfFlushTimeout):
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(emfFlushTimeout):
+	}
+}
+
+func (m *EMFMetrics) put(key metricKey, value float64) {
+	select {
+	case m.values <- metricValue{key: key, value: value}:
+	default:
+		atomic.AddInt64(&m.dropped, 1)
+	}
+}
+
+func (m *EMFMetrics) run() {
+	pending := make(map[metricKey][]float64)
+	ticker := time.NewTicker(emfFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case each := <-m.values:
+			pending[each.key] = append(pending[each.key], each.value)
+		case done := <-m.flushes:
+			//take what was put before Flush was called
+			for drained := false; !drained; {
+				select {
+				case each := <-m.values:
+					pending[each.key] = append(pending[each.key], each.value)
+				default:
+					drained = true
+				}
+			}
+			m.write(pending)
+			pending = make(map[metricKey][]float64)
+			close(done)
+		case <-ticker.C:
+			m.write(pending)
+			pending = make(map[metricKey][]float64)
+		}
+	}
+}
+
+func (m *EMFMetrics) write(pending map[metricKey][]float64) {
+	if dropped := atomic.SwapInt64(&m.dropped, 0); dropped != 0 {
+		Anlogger.Warnf(nil, "metrics.go : [%d] metric values were dropped because queue is full", dropped)
+	}
+	for key, values := range pending {
+		for len(values) != 0 {
+			size := len(values)
+			if size > emfMaxValues {
+				size = emfMaxValues
+			}
+			data, err := m.record(key, values[:size])
+			if err != nil {
+				Anlogger.Errorf(nil, "metrics.go : error marshaling metric [%s] : %v", key.name, err)
+				break
+			}
+			m.out.Write(append(data, '\n'))
+			values = values[size:]
+		}
+	}
+}
+
+func (m *EMFMetrics) record(key metricKey, values []float64) ([]byte, error) {
+	record := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": commons.UnixTimeInMillis(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  m.namespace,
+				"Dimensions": [][]string{{key.dimension}},
+				"Metrics":    []map[string]string{{"Name": key.name, "Unit": key.unit}},
+			}},
+		},
+		key.dimension: key.value,
+	}
+	if len(values) == 1 {
+		record[key.name] = values[0]
+	} else {
+		record[key.name] = values
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling emf record : %v", err)
+	}
+	return data, nil
+}
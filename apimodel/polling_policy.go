@@ -0,0 +1,124 @@
+package apimodel
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	//weight of the last internal call in the average latency
+	loadLatencyWeight = 0.2
+)
+
+//PollingPolicy computes RepeatRequestAfter and PullAgainAfter (both in millis) instead of fixed defaults
+type PollingPolicy struct {
+	//repeat request after is a half of lastActionTime lag within the bounds
+	MinRepeatRequestAfter int64
+	MaxRepeatRequestAfter int64
+
+	//chat with the last message younger than ActiveChat is pulled every MinPullAgainAfter,
+	//older than IdleChat (or without messages) every MaxPullAgainAfter, linear in between
+	MinPullAgainAfter int64
+	MaxPullAgainAfter int64
+	ActiveChat        time.Duration
+	IdleChat          time.Duration
+
+	//both values are multiplied by 1 + load, so clients poll up to two times slower when backend is slow
+	Load *LoadTracker
+}
+
+func DefaultPollingPolicy() *PollingPolicy {
+	return &PollingPolicy{
+		MinRepeatRequestAfter: 300,
+		MaxRepeatRequestAfter: 5000,
+		MinPullAgainAfter:     1000,
+		MaxPullAgainAfter:     15000,
+		ActiveChat:            2 * time.Minute,
+		IdleChat:              time.Hour,
+		Load:                  NewLoadTracker(time.Second),
+	}
+}
+
+//Polling has default bounds until InitPolling
+var Polling = DefaultPollingPolicy()
+
+func InitPolling(config Config) {
+	Polling = &PollingPolicy{
+		MinRepeatRequestAfter: config.PollingMinRepeatRequestAfterMs,
+		MaxRepeatRequestAfter: config.PollingMaxRepeatRequestAfterMs,
+		MinPullAgainAfter:     config.PollingMinPullAgainAfterMs,
+		MaxPullAgainAfter:     config.PollingMaxPullAgainAfterMs,
+		ActiveChat:            time.Duration(config.PollingActiveChatSec) * time.Second,
+		IdleChat:              time.Duration(config.PollingIdleChatSec) * time.Second,
+		Load:                  NewLoadTracker(time.Duration(config.PollingSlowLatencyMs) * time.Millisecond),
+	}
+}
+
+//RepeatRequestAfter for the case when internal lastActionTime is behind requested one by lag millis
+func (p *PollingPolicy) RepeatRequestAfter(lag int64) int64 {
+	repeat := clamp(lag/2, p.MinRepeatRequestAfter, p.MaxRepeatRequestAfter)
+	return p.withLoad(repeat)
+}
+
+//PullAgainAfter for the chat with the last message at lastMessageAt millis, 0 if there are no messages
+func (p *PollingPolicy) PullAgainAfter(lastMessageAt int64, now int64) int64 {
+	pull := p.MaxPullAgainAfter
+	if lastMessageAt > 0 {
+		idle := time.Duration(now-lastMessageAt) * time.Millisecond
+		switch {
+		case idle <= p.ActiveChat:
+			pull = p.MinPullAgainAfter
+		case idle < p.IdleChat:
+			part := float64(idle-p.ActiveChat) / float64(p.IdleChat-p.ActiveChat)
+			pull = p.MinPullAgainAfter + int64(part*float64(p.MaxPullAgainAfter-p.MinPullAgainAfter))
+		}
+	}
+	return p.withLoad(pull)
+}
+
+func (p *PollingPolicy) withLoad(value int64) int64 {
+	if p.Load == nil {
+		return value
+	}
+	return int64(math.Round(float64(value) * (1 + p.Load.Load())))
+}
+
+func clamp(value, min, max int64) int64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+//LoadTracker keeps average latency of internal calls of the container, failed calls count as slow ones
+type LoadTracker struct {
+	//average latency which means full load
+	slow time.Duration
+
+	mu      sync.Mutex
+	average float64
+}
+
+func NewLoadTracker(slow time.Duration) *LoadTracker {
+	return &LoadTracker{slow: slow}
+}
+
+func (t *LoadTracker) Observe(duration time.Duration, ok bool) {
+	if !ok && duration < t.slow {
+		duration = t.slow
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.average = t.average*(1-loadLatencyWeight) + float64(duration)*loadLatencyWeight
+}
+
+//Load is between 0 (idle) and 1 (average latency reached slow threshold)
+func (t *LoadTracker) Load() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return math.Min(1, t.average/float64(t.slow))
+}
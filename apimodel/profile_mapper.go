@@ -0,0 +1,95 @@
+package apimodel
+
+import (
+	"github.com/ringoid/commons"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type ProfileMapOptions struct {
+	//use unseen flag from internal profile instead of Unseen
+	UnseenFromInternal bool
+	Unseen             bool
+	IncludeMessages    bool
+	//auto means unit by viewer's locale
+	DistanceUnit DistanceUnit
+	//feature flags are checked for the viewer
+	Viewer FlagContext
+}
+
+//MapProfiles converts internal profiles into client ones, profiles without photos are skipped
+func MapProfiles(ctx context.Context, userId, resolution string, internalProfiles []commons.InternalProfiles, opts ProfileMapOptions, lc *lambdacontext.LambdaContext) []commons.Profile {
+	_, span := StartSpan(ctx, "map profiles", attribute.Int("internalProfiles", len(internalProfiles)))
+	defer span.End()
+
+	profiles := make([]commons.Profile, 0)
+	for _, each := range internalProfiles {
+		profile := MapProfile(userId, each, opts, lc)
+		if len(profile.Photos) == 0 {
+			Anlogger.Warnf(lc, "profile_mapper.go : internal function return user [%s] with empty photo list for resolution [%s] for userId [%s]",
+				each.UserId, resolution, userId)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+func MapProfile(userId string, internal commons.InternalProfiles, opts ProfileMapOptions, lc *lambdacontext.LambdaContext) commons.Profile {
+	settings := Settings()
+	photos := make([]commons.Photo, 0)
+	for _, eachPhoto := range internal.Photos {
+		photos = append(photos, commons.Photo{
+			PhotoId:           eachPhoto.ResizedPhotoId,
+			PhotoUri:          commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.Link, settings.CloudFrontDomain, settings.Env, settings.UseCloudFront),
+			ThumbnailPhotoUri: commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.ThumbnailLink, settings.CloudFrontDomain, settings.Env, settings.UseCloudFront),
+		})
+	}
+
+	lastOnlineText, lastOnlineFlag := TransformLastOnlineTimeIntoStatusText(userId, internal.LastOnlineTime, internal.SourceLocale, lc)
+	distanceText := TransformDistanceInDistanceText(userId, internal, opts.DistanceUnit, lc)
+
+	profile := commons.Profile{
+		UserId:         internal.UserId,
+		Photos:         photos,
+		Unseen:         opts.Unseen,
+		LastOnlineText: lastOnlineText,
+		LastOnlineFlag: lastOnlineFlag,
+		DistanceText:   distanceText,
+		Age:            internal.Age,
+		Sex:            internal.Sex,
+		Property:       internal.Property,
+		Transport:      internal.Transport,
+		Income:         internal.Income,
+		Height:         internal.Height,
+		EducationLevel: internal.EducationLevel,
+		HairColor:      internal.HairColor,
+		Children:       internal.Children,
+		Name:           internal.Name,
+		JobTitle:       internal.JobTitle,
+		Company:        internal.Company,
+		EducationText:  internal.EducationText,
+		About:          internal.About,
+		Instagram:      internal.Instagram,
+		TikTok:         internal.TikTok,
+		WhereLive:      internal.WhereLive,
+		WhereFrom:      internal.WhereFrom,
+		StatusText:     internal.StatusText,
+		TotalLikes:     internal.TotalLikes,
+	}
+
+	if opts.UnseenFromInternal {
+		profile.Unseen = internal.Unseen
+	}
+
+	if opts.IncludeMessages {
+		messages := make([]commons.Message, 0)
+		for _, eachMessage := range internal.Messages {
+			messages = append(messages, eachMessage)
+		}
+		profile.Messages = messages
+	}
+
+	return CheckProfileBeforeResponse(opts.Viewer, profile, lc)
+}
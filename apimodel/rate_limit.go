@@ -0,0 +1,198 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TooManyRequestsErrorCode = "TooManyRequestsClientError"
+
+	rateLimitUserKeyPrefix = "user"
+	rateLimitIpKeyPrefix   = "ip"
+
+	//memory store forgets full buckets when it has more keys
+	memoryRateLimitMaxKeys = 100000
+)
+
+//RateLimit is a token bucket, PerMinute tokens are added every minute up to Burst
+type RateLimit struct {
+	PerMinute float64 `json:"perMinute"`
+	Burst     int     `json:"burst"`
+}
+
+func (l RateLimit) enabled() bool {
+	return l.PerMinute > 0 && l.Burst > 0
+}
+
+//EndpointRateLimits are checked separately for the user and for the source ip, zero limit is not checked
+type EndpointRateLimits struct {
+	PerUser RateLimit `json:"perUser"`
+	PerIp   RateLimit `json:"perIp"`
+}
+
+//many users can share one ip behind NAT, so ip limits are higher than user ones
+var DefaultRateLimits = map[string]EndpointRateLimits{
+	"get_new_faces": {PerUser: RateLimit{PerMinute: 30, Burst: 10}, PerIp: RateLimit{PerMinute: 300, Burst: 60}},
+	"discover":      {PerUser: RateLimit{PerMinute: 30, Burst: 10}, PerIp: RateLimit{PerMinute: 300, Burst: 60}},
+	"get_lc":        {PerUser: RateLimit{PerMinute: 60, Burst: 15}, PerIp: RateLimit{PerMinute: 600, Burst: 100}},
+	"lmm":           {PerUser: RateLimit{PerMinute: 60, Burst: 15}, PerIp: RateLimit{PerMinute: 600, Burst: 100}},
+	"lmhis":         {PerUser: RateLimit{PerMinute: 60, Burst: 15}, PerIp: RateLimit{PerMinute: 600, Burst: 100}},
+	"chat":          {PerUser: RateLimit{PerMinute: 120, Burst: 30}, PerIp: RateLimit{PerMinute: 1200, Burst: 200}},
+}
+
+//RateLimitStore keeps buckets, memory store is per container, shared store (e.g. dynamodb) limits across containers
+type RateLimitStore interface {
+	//Take removes one token from the bucket of the key, returns how long to wait when there is no token
+	Take(key string, limit RateLimit, now time.Time) (bool, time.Duration, error)
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	maxKeys int
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*rateBucket), maxKeys: memoryRateLimitMaxKeys}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	perSecond := limit.PerMinute / 60
+	bucket, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= s.maxKeys {
+			s.forgetFull(now)
+		}
+		bucket = &rateBucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+	bucket.limit = limit
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	return false, wait, nil
+}
+
+//full bucket is the same as no bucket
+func (s *MemoryRateLimitStore) forgetFull(now time.Time) {
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updated).Minutes()*bucket.limit.PerMinute+bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+type RateLimiter struct {
+	store   RateLimitStore
+	limits  map[string]EndpointRateLimits
+	enabled bool
+}
+
+//Limiter is disabled until InitRateLimiter
+var Limiter = &RateLimiter{}
+
+func NewRateLimiter(store RateLimitStore, limits map[string]EndpointRateLimits) *RateLimiter {
+	return &RateLimiter{store: store, limits: limits, enabled: true}
+}
+
+//InitRateLimiter sets Limiter with default limits overridden by RATE_LIMITS
+func InitRateLimiter(config Config, store RateLimitStore) error {
+	if !config.RateLimitEnabled {
+		Limiter = &RateLimiter{}
+		return nil
+	}
+	limits, err := parseRateLimits(config.RateLimits)
+	if err != nil {
+		return err
+	}
+	Limiter = NewRateLimiter(store, limits)
+	return nil
+}
+
+//parseRateLimits merges json object endpoint -> limits into defaults
+func parseRateLimits(raw string) (map[string]EndpointRateLimits, error) {
+	limits := make(map[string]EndpointRateLimits, len(DefaultRateLimits))
+	for endpoint, each := range DefaultRateLimits {
+		limits[endpoint] = each
+	}
+	if len(raw) == 0 {
+		return limits, nil
+	}
+	var overrides map[string]EndpointRateLimits
+	err := json.Unmarshal([]byte(raw), &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rate limits [%s] : %v", raw, err)
+	}
+	for endpoint, each := range overrides {
+		if _, ok := DefaultRateLimits[endpoint]; !ok {
+			return nil, fmt.Errorf("rate limits contain unknown endpoint [%s]", endpoint)
+		}
+		limits[endpoint] = each
+	}
+	return limits, nil
+}
+
+//AllowIp is checked before auth, so flood of requests with wrong tokens doesn't reach auth function
+func (l *RateLimiter) AllowIp(endpoint, sourceIp string, lc *lambdacontext.LambdaContext) (bool, string) {
+	ip := ClientIp(sourceIp)
+	if len(ip) == 0 {
+		return true, ""
+	}
+	return l.take(endpoint, rateLimitIpKeyPrefix, ip, l.limits[endpoint].PerIp, lc)
+}
+
+func (l *RateLimiter) AllowUser(endpoint, userId string, lc *lambdacontext.LambdaContext) (bool, string) {
+	return l.take(endpoint, rateLimitUserKeyPrefix, userId, l.limits[endpoint].PerUser, lc)
+}
+
+func (l *RateLimiter) take(endpoint, prefix, id string, limit RateLimit, lc *lambdacontext.LambdaContext) (bool, string) {
+	if !l.enabled || !limit.enabled() {
+		return true, ""
+	}
+	key := fmt.Sprintf("%s:%s:%s", endpoint, prefix, id)
+	ok, wait, err := l.store.Take(key, limit, time.Now())
+	if err != nil {
+		//limiter should not take the service down
+		Anlogger.Warnf(lc, "rate_limit.go : error checking rate limit of [%s] for endpoint [%s], allow request : %v", prefix, endpoint, err)
+		return true, ""
+	}
+	if ok {
+		return true, ""
+	}
+	Anlogger.Warnf(lc, "rate_limit.go : %s [%s] exceeded rate limit of endpoint [%s], retry after [%v]", prefix, id, endpoint, wait)
+	return false, TooManyRequestsError(wait)
+}
+
+//TooManyRequestsError is client error with retry hint in seconds
+func TooManyRequestsError(retryAfter time.Duration) string {
+	retryAfterSec := int64(math.Ceil(retryAfter.Seconds()))
+	if retryAfterSec < 1 {
+		retryAfterSec = 1
+	}
+	return ClientError{ErrorCode: TooManyRequestsErrorCode, ErrorMessage: "Too many requests", RetryAfterSec: retryAfterSec}.String()
+}
+
+//ClientIp returns the last address of x-forwarded-for, which is appended by ALB. Addresses before it
+//come from the client and can be anything.
+func ClientIp(forwardedFor string) string {
+	addresses := strings.Split(forwardedFor, ",")
+	return strings.TrimSpace(addresses[len(addresses)-1])
+}
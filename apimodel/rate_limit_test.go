@@ -0,0 +1,90 @@
+package apimodel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+	type take struct {
+		key  string
+		at   time.Duration
+		ok   bool
+		wait time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst",
+			takes: []take{
+				{key: "u1", ok: true},
+				{key: "u1", ok: true},
+				{key: "u1", ok: false, wait: time.Second},
+			},
+		},
+		{
+			name: "refill",
+			takes: []take{
+				{key: "u1", ok: true},
+				{key: "u1", ok: true},
+				{key: "u1", at: 500 * time.Millisecond, ok: false, wait: 500 * time.Millisecond},
+				{key: "u1", at: time.Second, ok: true},
+				{key: "u1", at: time.Second, ok: false, wait: time.Second},
+			},
+		},
+		{
+			name: "refill up to burst",
+			takes: []take{
+				{key: "u1", ok: true},
+				{key: "u1", at: time.Minute, ok: true},
+				{key: "u1", at: time.Minute, ok: true},
+				{key: "u1", at: time.Minute, ok: false, wait: time.Second},
+			},
+		},
+		{
+			name: "own bucket per key",
+			takes: []take{
+				{key: "u1", ok: true},
+				{key: "u1", ok: true},
+				{key: "u2", ok: true},
+				{key: "u1", ok: false, wait: time.Second},
+			},
+		},
+	}
+	start := time.Now()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryRateLimitStore()
+			for i, each := range test.takes {
+				ok, wait, err := store.Take(each.key, limit, start.Add(each.at))
+				if err != nil {
+					t.Fatalf("take %d : error %v", i, err)
+				}
+				if ok != each.ok || wait != each.wait {
+					t.Fatalf("take %d : ok is %v and wait is %v, want %v and %v", i, ok, wait, each.ok, each.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreForgetsFullBuckets(t *testing.T) {
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+	store := NewMemoryRateLimitStore()
+	store.maxKeys = 2
+	start := time.Now()
+	store.Take("u1", limit, start)
+	store.Take("u2", limit, start)
+	store.Take("u2", limit, start)
+	//u1 is full again a second later, u2 is not
+	store.Take("u3", limit, start.Add(time.Second))
+	if _, ok := store.buckets["u1"]; ok {
+		t.Errorf("full bucket of u1 is kept")
+	}
+	if _, ok := store.buckets["u2"]; !ok {
+		t.Errorf("bucket of u2 is forgotten")
+	}
+}
@@ -0,0 +1,303 @@
+package apimodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	redactedValue = "***"
+)
+
+//lower case json keys, query params and headers which are never logged
+var redactedKeys = map[string]bool{
+	"accesstoken":   true,
+	"token":         true,
+	"authorization": true,
+	"cookie":        true,
+	"name":          true,
+	"lat":           true,
+	"lon":           true,
+	"slat":          true,
+	"slon":          true,
+	"latitude":      true,
+	"longitude":     true,
+	"text":          true,
+	"instagram":     true,
+	"tiktok":        true,
+	//config fields are marshaled with go names
+	"salt":                true,
+	"locationprivacysalt": true,
+}
+
+//secrets which can appear in plain text messages of commons functions, e.g. access token which is being verified,
+//secret -> number of calls which mask it now
+var maskedSecrets = struct {
+	mu     sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+//MaskSecret replaces the value with *** in messages written through CommonsBridge until returned unmask is called.
+//Commons functions log asynchronously, so call DrainCommonsLogs before unmask.
+func MaskSecret(secret string) func() {
+	if len(secret) == 0 {
+		return func() {}
+	}
+	maskedSecrets.mu.Lock()
+	maskedSecrets.counts[secret]++
+	maskedSecrets.mu.Unlock()
+	return func() {
+		maskedSecrets.mu.Lock()
+		defer maskedSecrets.mu.Unlock()
+		if maskedSecrets.counts[secret]--; maskedSecrets.counts[secret] <= 0 {
+			delete(maskedSecrets.counts, secret)
+		}
+	}
+}
+
+func maskSecrets(s string) string {
+	maskedSecrets.mu.Lock()
+	defer maskedSecrets.mu.Unlock()
+	for secret := range maskedSecrets.counts {
+		s = strings.Replace(s, secret, redactedValue, -1)
+	}
+	return s
+}
+
+//RedactText redacts json objects and arrays inside of the plain text message and masks secrets
+func RedactText(s string) string {
+	s = maskSecrets(s)
+	var result strings.Builder
+	for {
+		start := strings.IndexAny(s, "{[")
+		if start < 0 {
+			result.WriteString(s)
+			return result.String()
+		}
+		result.WriteString(s[:start])
+		s = s[start:]
+		decoder := json.NewDecoder(strings.NewReader(s))
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			result.WriteString(s[:1])
+			s = s[1:]
+			continue
+		}
+		end := int(decoder.InputOffset())
+		result.WriteString(redactJSONString(s[:end]))
+		s = s[end:]
+	}
+}
+
+//RedactingLogger scrubs tokens and personal data from all arguments before they reach the next logger
+type RedactingLogger struct {
+	next   Logger
+	fields Fields
+}
+
+func NewRedactingLogger(next Logger) *RedactingLogger {
+	return &RedactingLogger{next: next}
+}
+
+//WithFields returns logger which adds fields to every record
+func (l *RedactingLogger) WithFields(fields Fields) *RedactingLogger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		if redactedKeys[strings.ToLower(key)] {
+			value = redactedValue
+		}
+		merged[key] = Redact(value)
+	}
+	return &RedactingLogger{next: l.next, fields: merged}
+}
+
+func (l *RedactingLogger) Debugf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	//don't pay for redaction of messages which are dropped anyway
+	if !IsDebugLogEnabled {
+		return
+	}
+	l.log(levelDebug, lc, s, v)
+}
+
+func (l *RedactingLogger) Infof(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.log(levelInfo, lc, s, v)
+}
+
+func (l *RedactingLogger) Warnf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.log(levelWarn, lc, s, v)
+}
+
+func (l *RedactingLogger) Errorf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.log(levelError, lc, s, v)
+}
+
+func (l *RedactingLogger) Fatalf(lc *lambdacontext.LambdaContext, s string, v ...interface{}) {
+	l.log(levelFatal, lc, s, v)
+}
+
+func (l *RedactingLogger) AwsLog(args ...interface{}) {
+	l.next.AwsLog(RedactArgs(args)...)
+}
+
+func (l *RedactingLogger) log(level string, lc *lambdacontext.LambdaContext, s string, v []interface{}) {
+	v = RedactArgs(v)
+	if structured, ok := l.next.(fieldLogger); ok {
+		structured.Logf(level, lc, l.fields, s, v...)
+		if level == levelFatal {
+			os.Exit(1)
+		}
+		return
+	}
+	//plain text loggers get request id at the end of the message
+	if requestId := RequestId(lc); len(requestId) != 0 {
+		s += ", requestId [%s]"
+		v = append(v, requestId)
+	}
+	switch level {
+	case levelDebug:
+		l.next.Debugf(lc, s, v...)
+	case levelInfo:
+		l.next.Infof(lc, s, v...)
+	case levelWarn:
+		l.next.Warnf(lc, s, v...)
+	case levelError:
+		l.next.Errorf(lc, s, v...)
+	default:
+		l.next.Fatalf(lc, s, v...)
+	}
+}
+
+func RedactArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, each := range args {
+		redacted[i] = Redact(each)
+	}
+	return redacted
+}
+
+//Redact returns safe to log copy of the value, structs, maps and slices are logged as redacted json
+func Redact(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case nil:
+		return nil
+	case error:
+		return v
+	case events.ALBTargetGroupRequest:
+		return redactALBRequest(v)
+	case *events.ALBTargetGroupRequest:
+		if v == nil {
+			return v
+		}
+		return redactALBRequest(*v)
+	case string:
+		return redactJSONString(v)
+	case []byte:
+		return redactJSONString(string(v))
+	case []interface{}:
+		return RedactArgs(v)
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(arg)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		//own String hides what the type knows to be secret, e.g. Config
+		if stringer, ok := arg.(fmt.Stringer); ok {
+			return redactJSONString(stringer.String())
+		}
+		data, err := json.Marshal(arg)
+		if err != nil {
+			return fmt.Sprintf("<%T>", arg)
+		}
+		return redactJSONString(string(data))
+	}
+	return arg
+}
+
+func redactALBRequest(request events.ALBTargetGroupRequest) events.ALBTargetGroupRequest {
+	request.QueryStringParameters = redactStringMap(request.QueryStringParameters)
+	request.Headers = redactStringMap(request.Headers)
+	if request.MultiValueQueryStringParameters != nil {
+		params := make(map[string][]string, len(request.MultiValueQueryStringParameters))
+		for key, values := range request.MultiValueQueryStringParameters {
+			if redactedKeys[strings.ToLower(key)] {
+				values = []string{redactedValue}
+			}
+			params[key] = values
+		}
+		request.MultiValueQueryStringParameters = params
+	}
+	if len(request.Body) != 0 {
+		if isJSON(request.Body) {
+			request.Body = redactJSONString(request.Body)
+		} else {
+			request.Body = redactedValue
+		}
+	}
+	return request
+}
+
+func redactStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(values))
+	for key, value := range values {
+		if redactedKeys[strings.ToLower(key)] {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+func isJSON(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")
+}
+
+//not json strings are returned as is
+func redactJSONString(s string) string {
+	if !isJSON(s) {
+		return s
+	}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return s
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redactJSONValue(data)); err != nil {
+		return s
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func redactJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, each := range v {
+			if redactedKeys[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactJSONValue(each)
+			}
+		}
+	case []interface{}:
+		for i, each := range v {
+			v[i] = redactJSONValue(each)
+		}
+	}
+	return value
+}
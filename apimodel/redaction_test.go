@@ -0,0 +1,106 @@
+package apimodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain text", in: "call function [auth] for userId [u1]", want: "call function [auth] for userId [u1]"},
+		{name: "json object", in: `request {"accessToken":"secret","userId":"u1"} sent`, want: `request {"accessToken":"***","userId":"u1"} sent`},
+		{name: "nested keys", in: `{"profile":{"lat":1.5,"lon":2.5,"age":30}}`, want: `{"profile":{"age":30,"lat":"***","lon":"***"}}`},
+		{name: "array of objects", in: `messages [{"text":"hi"},{"text":"bye"}]`, want: `messages [{"text":"***"},{"text":"***"}]`},
+		{name: "not json brackets", in: "userId [u1] {not json", want: "userId [u1] {not json"},
+	}
+	for _, each := range tests {
+		t.Run(each.name, func(t *testing.T) {
+			if got := RedactText(each.in); got != each.want {
+				t.Errorf("RedactText(%q) = %q, want %q", each.in, got, each.want)
+			}
+		})
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	const message = "verify access token [tok-123] of the user"
+	unmask := MaskSecret("tok-123")
+	again := MaskSecret("tok-123")
+	if got := RedactText(message); strings.Contains(got, "tok-123") {
+		t.Errorf("masked secret is logged : %s", got)
+	}
+	unmask()
+	if got := RedactText(message); strings.Contains(got, "tok-123") {
+		t.Errorf("secret is unmasked while another call still masks it : %s", got)
+	}
+	again()
+	if got := RedactText(message); got != message {
+		t.Errorf("secret is still masked after all calls unmasked it : %s", got)
+	}
+}
+
+type loggedStruct struct {
+	UserId      string `json:"userId"`
+	AccessToken string `json:"accessToken"`
+}
+
+type stringerStruct struct {
+	Salt string
+}
+
+func (s stringerStruct) String() string {
+	return `{"mode":"jitter"}`
+}
+
+func TestRedactingLogger(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields Fields
+		format string
+		args   []interface{}
+		want   string
+		//fields which the record should have with these values
+		wantFields map[string]interface{}
+	}{
+		{name: "struct argument", format: "request %v", args: []interface{}{loggedStruct{UserId: "u1", AccessToken: "secret"}},
+			want: `request {"accessToken":"***","userId":"u1"}`},
+		{name: "json string argument", format: "body %s", args: []interface{}{`{"name":"Alice","age":30}`},
+			want: `body {"age":30,"name":"***"}`},
+		{name: "own String is used", format: "config %v", args: []interface{}{stringerStruct{Salt: "secret"}},
+			want: `config {"mode":"jitter"}`},
+		{name: "redacted field", fields: Fields{"userId": "u1", "accessToken": "secret"}, format: "done",
+			want: "done", wantFields: map[string]interface{}{"userId": "u1", "accessToken": "***"}},
+	}
+	for _, each := range tests {
+		t.Run(each.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewRedactingLogger(NewJSONLogger(&buf, "test"))
+			if each.fields != nil {
+				logger = logger.WithFields(each.fields)
+			}
+			logger.Infof(nil, each.format, each.args...)
+
+			var record map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("record %s is not json : %v", buf.String(), err)
+			}
+			if record["message"] != each.want {
+				t.Errorf("message %q, want %q", record["message"], each.want)
+			}
+			for key, value := range each.wantFields {
+				if record[key] != value {
+					t.Errorf("field %s is %v, want %v", key, record[key], value)
+				}
+			}
+			if strings.Contains(buf.String(), "secret") {
+				t.Errorf("secret is logged : %s", buf.String())
+			}
+		})
+	}
+}
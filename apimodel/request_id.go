@@ -0,0 +1,80 @@
+package apimodel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"strings"
+)
+
+const (
+	//ALB adds it to every request, e.g. Root=1-67891233-abcdef012345678912345678
+	TraceIdHeader = "x-amzn-trace-id"
+	//key in lambda client context, internal payloads and analytic events
+	RequestIdKey = "requestId"
+)
+
+//RequestIdFromHeaders returns root of the trace id or generated id if there is no trace header
+func RequestIdFromHeaders(headers map[string]string) string {
+	traceId := strings.TrimSpace(headers[TraceIdHeader])
+	for _, each := range strings.Split(traceId, ";") {
+		if strings.HasPrefix(each, "Root=") && len(each) > len("Root=") {
+			return strings.TrimPrefix(each, "Root=")
+		}
+	}
+	if len(traceId) != 0 {
+		return traceId
+	}
+	return NewRequestId()
+}
+
+func NewRequestId() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+//WithRequestId returns copy of lambda context with request id, nil context (local run) is replaced with empty one
+func WithRequestId(lc *lambdacontext.LambdaContext, requestId string) *lambdacontext.LambdaContext {
+	withId := lambdacontext.LambdaContext{}
+	if lc != nil {
+		withId = *lc
+	}
+	custom := make(map[string]string, len(withId.ClientContext.Custom)+1)
+	for key, value := range withId.ClientContext.Custom {
+		custom[key] = value
+	}
+	custom[RequestIdKey] = requestId
+	withId.ClientContext.Custom = custom
+	return &withId
+}
+
+func RequestId(lc *lambdacontext.LambdaContext) string {
+	if lc == nil {
+		return ""
+	}
+	return lc.ClientContext.Custom[RequestIdKey]
+}
+
+//marshalWithRequestId marshals json object and adds requestId key to it, internal functions ignore unknown keys
+func marshalWithRequestId(value interface{}, lc *lambdacontext.LambdaContext) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	requestId := RequestId(lc)
+	if len(requestId) == 0 {
+		return data, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		//not an object, send as is
+		return data, nil
+	}
+	object[RequestIdKey], _ = json.Marshal(requestId)
+	return json.Marshal(object)
+}
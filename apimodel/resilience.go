@@ -0,0 +1,214 @@
+package apimodel
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ringoid/commons"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+//RetryPolicy is exponential backoff with full jitter, MaxAttempts includes the first call
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+//Delay before the retry, retry starts from 1
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if retry < 32 {
+		if backoff := p.BaseDelay << uint(retry-1); backoff > 0 && backoff < ceiling {
+			ceiling = backoff
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+//CircuitBreaker of one internal function opens after FailureThreshold failed calls in a row,
+//rejects calls for OpenTimeout and then lets one probe call through, which closes or opens it again.
+//State is per container, so every container finds out about failing function by itself.
+type CircuitBreaker struct {
+	functionName     string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(functionName string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{functionName: functionName, failureThreshold: failureThreshold, openTimeout: openTimeout, state: CircuitClosed}
+}
+
+func (c *CircuitBreaker) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+//Allow is false when the call should not be made, every allowed call has to be recorded
+func (c *CircuitBreaker) Allow(now time.Time, lc *lambdacontext.LambdaContext) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.openedAt) < c.openTimeout {
+			return false
+		}
+		c.transition(CircuitHalfOpen, lc)
+		c.probing = true
+		return true
+	case CircuitHalfOpen:
+		//only one probe at a time
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	}
+	return true
+}
+
+func (c *CircuitBreaker) Record(ok bool, now time.Time, lc *lambdacontext.LambdaContext) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probing = false
+	if ok {
+		c.failures = 0
+		if c.state != CircuitClosed {
+			c.transition(CircuitClosed, lc)
+		}
+		return
+	}
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= c.failureThreshold {
+		c.openedAt = now
+		if c.state != CircuitOpen {
+			c.transition(CircuitOpen, lc)
+		}
+	}
+}
+
+//Release lets the next probe through without recording the call
+func (c *CircuitBreaker) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probing = false
+}
+
+func (c *CircuitBreaker) transition(state string, lc *lambdacontext.LambdaContext) {
+	Anlogger.Warnf(lc, "resilience.go : circuit breaker of function [%s] changed state from [%s] to [%s] after [%d] failed calls in a row",
+		c.functionName, c.state, state, c.failures)
+	c.state = state
+	Metrics.CircuitBreakerState(c.functionName, state)
+}
+
+//ResiliencePolicy keeps circuit breakers of internal functions and retries retryable failures
+type ResiliencePolicy struct {
+	enabled          bool
+	retry            RetryPolicy
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+//Resilience is disabled until InitResilience
+var Resilience = &ResiliencePolicy{}
+
+func NewResiliencePolicy(retry RetryPolicy, failureThreshold int, openTimeout time.Duration) *ResiliencePolicy {
+	return &ResiliencePolicy{
+		enabled:          true,
+		retry:            retry,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		breakers:         make(map[string]*CircuitBreaker),
+	}
+}
+
+func InitResilience(config Config) {
+	if !config.ResilienceEnabled {
+		Resilience = &ResiliencePolicy{}
+		return
+	}
+	retry := RetryPolicy{
+		MaxAttempts: config.RetryMaxAttempts,
+		BaseDelay:   time.Duration(config.RetryBaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(config.RetryMaxDelayMs) * time.Millisecond,
+	}
+	Resilience = NewResiliencePolicy(retry, config.CircuitFailureThreshold, time.Duration(config.CircuitOpenSec)*time.Second)
+}
+
+func (r *ResiliencePolicy) Breaker(functionName string) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	breaker, ok := r.breakers[functionName]
+	if !ok {
+		breaker = NewCircuitBreaker(functionName, r.failureThreshold, r.openTimeout)
+		r.breakers[functionName] = breaker
+	}
+	return breaker
+}
+
+//Call makes attempts until one succeeds or fails with not retryable error, attempts are over or there is no time
+//left in ctx for the next one. Attempt returns ok, is failure retryable, is failure handled and error string.
+//Handled failure is an error answered by the function itself (handled FunctionError, bad status or payload),
+//it is about the request rather than availability of the function, so circuit breaker doesn't count it,
+//otherwise one user with a bad request could open the circuit for everybody. ok and error string
+func (r *ResiliencePolicy) Call(ctx context.Context, functionName, userId string,
+	attempt func(ctx context.Context) (bool, bool, bool, string), lc *lambdacontext.LambdaContext) (bool, string) {
+	if !r.enabled {
+		ok, _, _, errStr := attempt(ctx)
+		return ok, errStr
+	}
+
+	breaker := r.Breaker(functionName)
+	if !breaker.Allow(time.Now(), lc) {
+		Anlogger.Warnf(lc, "resilience.go : circuit breaker of function [%s] is open, skip call for userId [%s]", functionName, userId)
+		Metrics.CircuitBreakerRejection(functionName)
+		return false, commons.InternalServerError
+	}
+
+	ok, retryable, handled, errStr := attempt(ctx)
+	for retry := 1; !ok && retryable && retry < r.retry.MaxAttempts; retry++ {
+		delay := r.retry.Delay(retry)
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) <= delay {
+			break
+		}
+		Anlogger.Warnf(lc, "resilience.go : retry [%d] of function [%s] for userId [%s] after [%v]", retry, functionName, userId, delay)
+		Metrics.InternalCallRetry(functionName)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			errStr = internalCallErrorStr(ctx)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		ok, retryable, handled, errStr = attempt(ctx)
+	}
+
+	//call canceled by the caller (e.g. another section of fan-out failed) says nothing about the function
+	if !ok && (ctx.Err() == context.Canceled || handled) {
+		breaker.Release()
+		return ok, errStr
+	}
+	breaker.Record(ok, time.Now(), lc)
+	return ok, errStr
+}
@@ -0,0 +1,139 @@
+package apimodel
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const (
+		allow   = "allow"
+		success = "success"
+		failure = "failure"
+		release = "release"
+	)
+	type step struct {
+		action string
+		at     time.Duration
+		//result of allow
+		allowed bool
+		state   string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after failures in a row",
+			steps: []step{
+				{action: failure, state: CircuitClosed},
+				{action: failure, state: CircuitClosed},
+				{action: failure, state: CircuitOpen},
+				{action: allow, at: time.Second, allowed: false, state: CircuitOpen},
+			},
+		},
+		{
+			name: "success resets failures",
+			steps: []step{
+				{action: failure, state: CircuitClosed},
+				{action: failure, state: CircuitClosed},
+				{action: success, state: CircuitClosed},
+				{action: failure, state: CircuitClosed},
+				{action: failure, state: CircuitClosed},
+				{action: allow, allowed: true, state: CircuitClosed},
+			},
+		},
+		{
+			name: "probe closes after timeout",
+			steps: []step{
+				{action: failure},
+				{action: failure},
+				{action: failure, state: CircuitOpen},
+				{action: allow, at: 10 * time.Second, allowed: true, state: CircuitHalfOpen},
+				{action: success, at: 11 * time.Second, state: CircuitClosed},
+				{action: allow, at: 11 * time.Second, allowed: true, state: CircuitClosed},
+			},
+		},
+		{
+			name: "failed probe opens again",
+			steps: []step{
+				{action: failure},
+				{action: failure},
+				{action: failure, state: CircuitOpen},
+				{action: allow, at: 10 * time.Second, allowed: true, state: CircuitHalfOpen},
+				{action: failure, at: 11 * time.Second, state: CircuitOpen},
+				{action: allow, at: 20 * time.Second, allowed: false, state: CircuitOpen},
+				{action: allow, at: 21 * time.Second, allowed: true, state: CircuitHalfOpen},
+			},
+		},
+		{
+			name: "one probe at a time",
+			steps: []step{
+				{action: failure},
+				{action: failure},
+				{action: failure, state: CircuitOpen},
+				{action: allow, at: 10 * time.Second, allowed: true, state: CircuitHalfOpen},
+				{action: allow, at: 10 * time.Second, allowed: false, state: CircuitHalfOpen},
+				{action: release, at: 10 * time.Second, state: CircuitHalfOpen},
+				{action: allow, at: 10 * time.Second, allowed: true, state: CircuitHalfOpen},
+			},
+		},
+	}
+	start := time.Now()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker("likes-you", 3, 10*time.Second)
+			for i, each := range test.steps {
+				now := start.Add(each.at)
+				switch each.action {
+				case allow:
+					if allowed := breaker.Allow(now, nil); allowed != each.allowed {
+						t.Fatalf("step %d : allowed is %v, want %v", i, allowed, each.allowed)
+					}
+				case success, failure:
+					breaker.Record(each.action == success, now, nil)
+				case release:
+					breaker.Release()
+				}
+				if len(each.state) != 0 && breaker.State() != each.state {
+					t.Fatalf("step %d : state is [%s], want [%s]", i, breaker.State(), each.state)
+				}
+			}
+		})
+	}
+}
+
+func TestResiliencePolicyCountsOnlyInfrastructureFailures(t *testing.T) {
+	type attempt struct {
+		handled bool
+		errStr  string
+	}
+	handledError := attempt{handled: true, errStr: InternalServiceFunctionError}
+	crash := attempt{errStr: InternalServiceCrashError}
+	tests := []struct {
+		name     string
+		attempts []attempt
+		want     string
+	}{
+		{name: "handled errors keep circuit closed", attempts: []attempt{handledError, handledError, handledError, handledError}, want: CircuitClosed},
+		{name: "crashes open circuit", attempts: []attempt{crash, crash, crash}, want: CircuitOpen},
+		{name: "handled error does not reset crashes", attempts: []attempt{crash, crash, handledError, crash}, want: CircuitOpen},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := NewResiliencePolicy(RetryPolicy{MaxAttempts: 1}, 3, time.Minute)
+			for i, each := range test.attempts {
+				ok, errStr := policy.Call(context.Background(), "likes-you", "u1", func(ctx context.Context) (bool, bool, bool, string) {
+					return false, false, each.handled, each.errStr
+				}, nil)
+				if ok || errStr != each.errStr {
+					t.Fatalf("call %d : got (%v, %s), want (false, %s)", i, ok, errStr, each.errStr)
+				}
+			}
+			if state := policy.Breaker("likes-you").State(); state != test.want {
+				t.Errorf("state is [%s], want [%s]", state, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package apimodel
+
+const (
+	LikesYouSection = "likesYou"
+	MatchesSection  = "matches"
+	MessagesSection = "messages"
+	HellosSection   = "hellos"
+	InboxSection    = "inbox"
+	SentSection     = "sent"
+	//new faces and discover
+	NewFacesSection = "newFaces"
+
+	SectionStatusOk     = "ok"
+	SectionStatusFailed = "failed"
+
+	//query param which enables partial response in lmm and lmhis
+	PartialResponseParam = "partialResponse"
+)
+
+//SectionStatus is a status of each feed section, section fails if any of its parts fails
+type SectionStatus map[string]string
+
+func (s SectionStatus) MarkOk(section string) {
+	if _, ok := s[section]; !ok {
+		s[section] = SectionStatusOk
+	}
+}
+
+func (s SectionStatus) MarkFailed(section string) {
+	s[section] = SectionStatusFailed
+}
+
+func (s SectionStatus) IsOk(section string) bool {
+	return s[section] == SectionStatusOk
+}
+
+func (s SectionStatus) AnyFailed() bool {
+	for _, status := range s {
+		if status == SectionStatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+func (s SectionStatus) AllFailed() bool {
+	for _, status := range s {
+		if status != SectionStatusFailed {
+			return false
+		}
+	}
+	return true
+}
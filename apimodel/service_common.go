@@ -11,232 +11,197 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
-	"strings"
-	"strconv"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"time"
+	"encoding/json"
+	"context"
 )
 
-var Anlogger *commons.Logger
-var InternalAuthFunctionName string
-var GetNewFacesFunctionName string
-var DiscoverFunctionName string
-var GetLcLikesFunctionName string
-var GetLcMessagesFunctionName string
-var LikesYouFunctionName string
-var MatchesFunctionName string
-var MessagesFunctionName string
-var LMHISFunctionName string
-var ChatFunctionName string
-var PrepareNewFacesFunctionName string
+//Anlogger redacts personal data, use CommonsLogger only for commons functions which require *commons.Logger
+var Anlogger *RedactingLogger
+var CommonsLogger *commons.Logger
 var ClientLambda *lambda.Lambda
-var CommonStreamName string
 var AwsKinesisClient *kinesis.Kinesis
-var DeliveryStreamName string
 var AwsDeliveryStreamClient *firehose.Firehose
-
-var BaseCloudWatchNamespace string
-var NewFaceProfilesReturnMetricName string
-var LikesYouProfilesReturnMetricName string
-var MatchProfilesReturnMetricName string
-var MessageProfilesReturnMetricName string
-
 var AwsCWClient *cloudwatch.CloudWatch
-var Env string
-
-var CloudFrontDomain string
-var UseCloudFront bool
 
-var userIdStatusEnabledMap map[string]bool
+//loadedConfig is set once at start, use Settings to read it
+var loadedConfig Config
 
 func InitLambdaVars(lambdaName string) {
-	var ok bool
-	var papertrailAddress string
-	var err error
-	var awsSession *session.Session
-
-	Env, ok = os.LookupEnv("ENV")
-	if !ok {
-		fmt.Printf("lambda-initialization : service_common.go : env can not be empty ENV\n")
-		os.Exit(1)
-	}
-	fmt.Printf("lambda-initialization : service_common.go : start with ENV = [%s]\n", Env)
-
-	papertrailAddress, ok = os.LookupEnv("PAPERTRAIL_LOG_ADDRESS")
-	if !ok {
-		fmt.Printf("lambda-initialization : service_common.go : env can not be empty PAPERTRAIL_LOG_ADDRESS\n")
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Printf("lambda-initialization : service_common.go : %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("lambda-initialization : service_common.go : start with PAPERTRAIL_LOG_ADDRESS = [%s]\n", papertrailAddress)
+	fmt.Printf("lambda-initialization : service_common.go : start with ENV = [%s]\n", config.Env)
 
-	Anlogger, err = commons.New(papertrailAddress, fmt.Sprintf("%s-%s", Env, lambdaName), IsDebugLogEnabled)
+	CommonsLogger, Anlogger, err = newLoggers(config, lambdaName)
 	if err != nil {
-		fmt.Errorf("lambda-initialization : service_common.go : error during startup : %v\n", err)
+		fmt.Printf("lambda-initialization : service_common.go : error during startup : %v\n", err)
 		os.Exit(1)
 	}
 	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : logger was successfully initialized")
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with config %v", config)
 
-	InternalAuthFunctionName, ok = os.LookupEnv("INTERNAL_AUTH_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_AUTH_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_AUTH_FUNCTION_NAME = [%s]", InternalAuthFunctionName)
-
-	GetNewFacesFunctionName, ok = os.LookupEnv("INTERNAL_GET_NEW_FACES_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_GET_NEW_FACES_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_GET_NEW_FACES_FUNCTION_NAME = [%s]", GetNewFacesFunctionName)
-
-	DiscoverFunctionName, ok = os.LookupEnv("INTERNAL_DISCOVER_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_DISCOVER_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_DISCOVER_FUNCTION_NAME = [%s]", DiscoverFunctionName)
+	initSettings(config)
 
-	GetLcLikesFunctionName, ok = os.LookupEnv("INTERNAL_GET_LC_LIKES_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_GET_LC_LIKES_FUNCTION_NAME")
+	awsSession, err := session.NewSession(aws.NewConfig().
+		WithRegion(commons.Region).WithMaxRetries(commons.MaxRetries).
+		WithLogger(aws.LoggerFunc(func(args ...interface{}) { Anlogger.AwsLog(args) })).WithLogLevel(aws.LogOff))
+	if err != nil {
+		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error during initialization : %v", err)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_GET_LC_LIKES_FUNCTION_NAME = [%s]", GetLcLikesFunctionName)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : aws session was successfully initialized")
 
-	GetLcMessagesFunctionName, ok = os.LookupEnv("INTERNAL_GET_LC_MSG_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_GET_LC_MSG_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_GET_LC_MSG_FUNCTION_NAME = [%s]", GetLcMessagesFunctionName)
+	ClientLambda = lambda.New(awsSession)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : lambda client was successfully initialized")
 
-	LikesYouFunctionName, ok = os.LookupEnv("INTERNAL_LIKES_YOU_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_LIKES_YOU_FUNCTION_NAME")
+	err = InitTracing(config, lambdaName)
+	if err != nil {
+		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error during tracing initialization : %v", err)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_LIKES_YOU_FUNCTION_NAME = [%s]", LikesYouFunctionName)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : tracing was successfully initialized")
 
-	MatchesFunctionName, ok = os.LookupEnv("INTERNAL_MATCHES_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_MATCHES_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_MATCHES_FUNCTION_NAME = [%s]", MatchesFunctionName)
+	InitMetrics(config, os.Stdout)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : metrics were successfully initialized")
 
-	MessagesFunctionName, ok = os.LookupEnv("INTERNAL_MESSAGES_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_MESSAGES_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_MESSAGES_FUNCTION_NAME = [%s]", MessagesFunctionName)
+	//cache is outside of instrumentation, so spans and error counters show only real auth calls
+	Backend = withAuthCache(NewInstrumentedFeedsBackend(withHedging(NewLambdaFeedsBackend(ClientLambda), config)), config)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : feeds backend was successfully initialized")
 
-	LMHISFunctionName, ok = os.LookupEnv("INTERNAL_LMHIS_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_LMHIS_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_LMHIS_FUNCTION_NAME = [%s]", LMHISFunctionName)
+	AwsKinesisClient = kinesis.New(awsSession)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : kinesis client was successfully initialized")
 
-	ChatFunctionName, ok = os.LookupEnv("INTERNAL_CHAT_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_CHAT_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_CHAT_FUNCTION_NAME = [%s]", ChatFunctionName)
+	AwsDeliveryStreamClient = firehose.New(awsSession)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : firehose client was successfully initialized")
 
-	PrepareNewFacesFunctionName, ok = os.LookupEnv("INTERNAL_PREPARE_NF_FUNCTION_NAME")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty INTERNAL_PREPARE_NF_FUNCTION_NAME")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with INTERNAL_PREPARE_NF_FUNCTION_NAME = [%s]", PrepareNewFacesFunctionName)
+	AwsCWClient = cloudwatch.New(awsSession)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : cloudwatch client was successfully initialized")
 
-	CommonStreamName, ok = os.LookupEnv("COMMON_STREAM")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty COMMON_STREAM")
+	var flagStore FlagStore
+	if len(config.FeatureFlagsBucket) != 0 {
+		flagStore = S3FlagStore{Client: s3.New(awsSession), Bucket: config.FeatureFlagsBucket, Key: config.FeatureFlagsKey}
+	} else if len(config.FeatureFlagsFile) != 0 {
+		flagStore = FileFlagStore{FileName: config.FeatureFlagsFile}
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with COMMON_STREAM = [%s]", CommonStreamName)
+	InitFeatureFlags(flagStore, config)
 
-	DeliveryStreamName, ok = os.LookupEnv("DELIVERY_STREAM")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty DELIVERY_STREAM")
+	err = InitRateLimiter(config, NewMemoryRateLimitStore())
+	if err != nil {
+		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error during rate limiter initialization : %v", err)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with DELIVERY_STREAM = [%s]", DeliveryStreamName)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : rate limiter was successfully initialized")
 
-	BaseCloudWatchNamespace, ok = os.LookupEnv("BASE_CLOUD_WATCH_NAMESPACE")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty BASE_CLOUD_WATCH_NAMESPACE")
+	err = InitFallback(config)
+	if err != nil {
+		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error during fallback initialization : %v", err)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with BASE_CLOUD_WATCH_NAMESPACE = [%s]", BaseCloudWatchNamespace)
+	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : fallback was successfully initialized")
+}
 
-	NewFaceProfilesReturnMetricName, ok = os.LookupEnv("CLOUD_WATCH_NEW_FACES_RETURN")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty CLOUD_WATCH_NEW_FACES_RETURN")
+//InitLocalVars initializes everything handlers need to run outside of AWS, internal functions are served by backend
+func InitLocalVars(lambdaName string, backend FeedsBackend) {
+	config, err := LoadLocalConfig()
+	if err != nil {
+		fmt.Printf("local-initialization : service_common.go : %v\n", err)
+		os.Exit(1)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with CLOUD_WATCH_NEW_FACES_RETURN = [%s]", NewFaceProfilesReturnMetricName)
+	fmt.Printf("local-initialization : service_common.go : start with ENV = [%s]\n", config.Env)
 
-	LikesYouProfilesReturnMetricName, ok = os.LookupEnv("CLOUD_WATCH_LIKES_YOU_RETURN")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty CLOUD_WATCH_LIKES_YOU_RETURN")
+	CommonsLogger, Anlogger, err = newLoggers(config, lambdaName)
+	if err != nil {
+		fmt.Printf("local-initialization : service_common.go : error during startup : %v\n", err)
+		os.Exit(1)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with CLOUD_WATCH_LIKES_YOU_RETURN = [%s]", LikesYouProfilesReturnMetricName)
 
-	MatchProfilesReturnMetricName, ok = os.LookupEnv("CLOUD_WATCH_MATCHES_RETURN")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty CLOUD_WATCH_MATCHES_RETURN")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with CLOUD_WATCH_MATCHES_RETURN = [%s]", MatchProfilesReturnMetricName)
+	initSettings(config)
 
-	MessageProfilesReturnMetricName, ok = os.LookupEnv("CLOUD_WATCH_MESSAGES_RETURN")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty CLOUD_WATCH_MESSAGES_RETURN")
+	var flagStore FlagStore
+	if len(config.FeatureFlagsFile) != 0 {
+		flagStore = FileFlagStore{FileName: config.FeatureFlagsFile}
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with CLOUD_WATCH_MESSAGES_RETURN = [%s]", MessageProfilesReturnMetricName)
+	InitFeatureFlags(flagStore, config)
 
-	CloudFrontDomain, ok = os.LookupEnv("CLOUDFRONT_DISTRIBUTION_DOMAIN")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty CLOUDFRONT_DISTRIBUTION_DOMAIN")
+	err = InitRateLimiter(config, NewMemoryRateLimitStore())
+	if err != nil {
+		fmt.Printf("local-initialization : service_common.go : error during rate limiter initialization : %v\n", err)
+		os.Exit(1)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with CLOUDFRONT_DISTRIBUTION_DOMAIN = [%s]", CloudFrontDomain)
 
-	cloudFrontEnabled, ok := os.LookupEnv("USE_CLOUDFRONT")
-	if !ok {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : env can not be empty USE_CLOUDFRONT")
-	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : start with USE_CLOUDFRONT = [%s]", cloudFrontEnabled)
-	b, err := strconv.ParseBool(cloudFrontEnabled)
+	err = InitFallback(config)
 	if err != nil {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error parse USE_CLOUDFRONT to bool : %v", err)
+		fmt.Printf("local-initialization : service_common.go : error during fallback initialization : %v\n", err)
+		os.Exit(1)
 	}
-	UseCloudFront = b
 
-	awsSession, err = session.NewSession(aws.NewConfig().
-		WithRegion(commons.Region).WithMaxRetries(commons.MaxRetries).
-		WithLogger(aws.LoggerFunc(func(args ...interface{}) { Anlogger.AwsLog(args) })).WithLogLevel(aws.LogOff))
+	err = InitTracing(config, lambdaName)
 	if err != nil {
-		Anlogger.Fatalf(nil, "lambda-initialization : service_common.go : error during initialization : %v", err)
+		fmt.Printf("local-initialization : service_common.go : error during tracing initialization : %v\n", err)
+		os.Exit(1)
 	}
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : aws session was successfully initialized")
 
-	ClientLambda = lambda.New(awsSession)
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : lambda client was successfully initialized")
+	InitMetrics(config, os.Stdout)
 
-	AwsKinesisClient = kinesis.New(awsSession)
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : kinesis client was successfully initialized")
+	Backend = withAuthCache(NewInstrumentedFeedsBackend(withHedging(backend, config)), config)
+	Anlogger.Debugf(nil, "local-initialization : service_common.go : local vars were successfully initialized with config %v", config)
+}
 
-	AwsDeliveryStreamClient = firehose.New(awsSession)
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : firehose client was successfully initialized")
+//Settings returns the config the service was started with
+func Settings() Config {
+	return loadedConfig
+}
 
-	AwsCWClient = cloudwatch.New(awsSession)
-	Anlogger.Debugf(nil, "lambda-initialization : service_common.go : cloudwatch client was successfully initialized")
+//initSettings keeps the config for Settings and configures subsystems which are used by handlers
+func initSettings(config Config) {
+	loadedConfig = config
+	InitLocationPrivacy(config)
+	InitCoalescing(config)
+	InitResilience(config)
+	InitPolling(config)
+}
 
-	userIdStatusEnabledMap = make(map[string]bool)
-	//Kirill
-	userIdStatusEnabledMap["d0b285a7d39f07e528dfba085e07a6135ddde188"] = true
-	userIdStatusEnabledMap["ea6fa85e8afcf574d50c59b1d6cd1f2217fb718c"] = true
-	userIdStatusEnabledMap["b9094fec646aa6296d0d3b3238801f92af34083a"] = true
-	userIdStatusEnabledMap["54047644372b264ee02a1ac4e47cc6d02fc517bd"] = true
-	//Iam
-	userIdStatusEnabledMap["471d36399d776b7e3c4e031bf5e25cc67b452378"] = true
-	//Victor
-	userIdStatusEnabledMap["c86a29c241f8a0dadf3cff31b4c831bbfe3f2633"] = true
-	//Maxim
-	userIdStatusEnabledMap["f966276704b50ec1d472e34bbd184d89082bcdfb"] = true
+//InitFeatureFlags loads flags at start, service starts with all flags disabled if the document is broken
+func InitFeatureFlags(store FlagStore, config Config) {
+	Flags = NewFeatureFlags(store, time.Duration(config.FeatureFlagsRefreshSec)*time.Second)
+	if store == nil {
+		Anlogger.Debugf(nil, "initialization : service_common.go : there is no feature flags store, all flags are disabled")
+		return
+	}
+	err := Flags.Refresh(context.Background())
+	if err != nil {
+		Anlogger.Errorf(nil, "initialization : service_common.go : error loading feature flags : %v", err)
+		return
+	}
+	Anlogger.Debugf(nil, "initialization : service_common.go : feature flags were successfully loaded")
+}
+
+//SendAnalyticEvent skips the event when there is no delivery stream (local run)
+func SendAnalyticEvent(event interface{}, userId string, lc *lambdacontext.LambdaContext) {
+	if AwsDeliveryStreamClient == nil {
+		Anlogger.Debugf(lc, "service_common.go : there is no delivery stream, skip analytic event %v for userId [%s]", event, userId)
+		return
+	}
+	commons.SendAnalyticEvent(eventWithRequestId(event, lc), userId, Settings().DeliveryStreamName, AwsDeliveryStreamClient, CommonsLogger, lc)
+}
+
+//event is sent as json, so the same event with one more key is sent as a map
+func eventWithRequestId(event interface{}, lc *lambdacontext.LambdaContext) interface{} {
+	data, err := marshalWithRequestId(event, lc)
+	if err != nil {
+		return event
+	}
+	var withId map[string]interface{}
+	if err := json.Unmarshal(data, &withId); err != nil {
+		return event
+	}
+	return withId
 }
 
-func CheckProfileBeforeResponse(userId string, prof commons.Profile) (commons.Profile) {
-	//if exist := userIdStatusEnabledMap[userId]; !exist && Env == "prod" {
-	//	prof.Age = 0
-	//}
+func CheckProfileBeforeResponse(viewer FlagContext, prof commons.Profile, lc *lambdacontext.LambdaContext) (commons.Profile) {
+	if Flags.IsEnabled(HideAgeFlag, viewer, lc) {
+		prof.Age = 0
+	}
 	return prof
 }
 
@@ -332,38 +297,15 @@ func TransformLastOnlineTimeIntoStatusText(userId string, lastOnlineTime int64,
 		lastOnlineFlag = "unknown"
 	} else {
 		if diff <= 900000 { //15 min
-			lastOnlineText = "Online"
-			sl := strings.ToLower(sourceLocale)
-			if sl == "ru" || sl == "be" || sl == "ua" {
-				lastOnlineText = "Онлайн"
-			}
+			lastOnlineText = Localization.Text(sourceLocale, "lastOnline.online", 0)
 		} else if diff > 900000 && diff <= 3599999 { //15 min < 59.99 min
-			localM := "m ago"
-			sl := strings.ToLower(sourceLocale)
-			if sl == "ru" || sl == "be" || sl == "ua" {
-				localM = "мин назад"
-			}
-			lastOnlineText = fmt.Sprintf("%v%s", diff/60000, localM)
+			lastOnlineText = Localization.Text(sourceLocale, "lastOnline.minutesAgo", diff/60000)
 		} else if diff >= 3600000 && diff <= 86400000 { // 1h < 24h
-			localH := "h ago"
-			sl := strings.ToLower(sourceLocale)
-			if sl == "ru" || sl == "be" || sl == "ua" {
-				localH = "ч назад"
-			}
-			lastOnlineText = fmt.Sprintf("%v%s", diff/3600000, localH)
+			lastOnlineText = Localization.Text(sourceLocale, "lastOnline.hoursAgo", diff/3600000)
 		} else if diff > 86400000 && diff <= 172800000 { //24h < 48h
-			lastOnlineText = "Yesterday"
-			sl := strings.ToLower(sourceLocale)
-			if sl == "ru" || sl == "be" || sl == "ua" {
-				lastOnlineText = "Вчера"
-			}
+			lastOnlineText = Localization.Text(sourceLocale, "lastOnline.yesterday", 1)
 		} else if diff > 172800000 { //48h
-			localD := "d ago"
-			sl := strings.ToLower(sourceLocale)
-			if sl == "ru" || sl == "be" || sl == "ua" {
-				localD = "д назад"
-			}
-			lastOnlineText = fmt.Sprintf("%v%s", diff/86400000, localD)
+			lastOnlineText = Localization.Text(sourceLocale, "lastOnline.daysAgo", diff/86400000)
 		}
 
 		if lastOnlineFlag != "unknown" {
@@ -382,28 +324,14 @@ func TransformLastOnlineTimeIntoStatusText(userId string, lastOnlineTime int64,
 }
 
 //return distanceText
-func TransformDistanceInDistanceText(userId string, internal commons.InternalProfiles, lc *lambdacontext.LambdaContext) (string) {
+func TransformDistanceInDistanceText(userId string, internal commons.InternalProfiles, unit DistanceUnit, lc *lambdacontext.LambdaContext) (string) {
 	//Anlogger.Debugf(lc, "service_common.go : transform request [%v] to distance text for userId [%s]", internal, userId)
 	var distanceText string
 	if !internal.LocationExist {
 		//Anlogger.Debugf(lc, "service_common.go : one of the coordinates < 0, so set unknown distance text")
 		distanceText = "unknown"
 	} else {
-		distance := Distance(Point(internal.Lat, internal.Lon), Point(internal.SourceLat, internal.SourceLon))
-		//Anlogger.Debugf(lc, "service_common.go : distance is [%v]", distance)
-		if distance <= 1000 {
-			distanceText = "1 "
-		} else if distance > 1000 {
-			distanceText = fmt.Sprintf("%d ", int(distance/1000))
-		}
-	}
-	if distanceText != "unknown" {
-		localKm := "km"
-		sl := strings.ToLower(internal.SourceLocale)
-		if sl == "ru" || sl == "be" || sl == "ua" {
-			localKm = "км"
-		}
-		distanceText = fmt.Sprintf("%s%s", distanceText, localKm)
+		distanceText = DistancePrivacy.DistanceText(internal, unit)
 	}
 
 	//Anlogger.Debugf(lc, "service_common.go : successfully transform request [%v] to distance text [%s] for userId [%s]", internal, distanceText, userId)
@@ -0,0 +1,58 @@
+package apimodel
+
+import (
+	"context"
+	"time"
+	"github.com/ringoid/commons"
+)
+
+const (
+	//ALB closes the connection after idle timeout, so we have to answer earlier
+	DefaultRequestTimeout = 25 * time.Second
+	//time to marshal response and send analytics after internal calls
+	ResponseSafetyMargin       = 1 * time.Second
+	DefaultInternalCallTimeout = 10 * time.Second
+	asyncInternalCallTimeout   = 3 * time.Second
+	//auth is a lookup by token, the rest of the request waits for it
+	authInternalCallTimeout = 3 * time.Second
+	//one section of get_lc, lmm or lmhis and chat, several of them run in parallel
+	sectionInternalCallTimeout = 5 * time.Second
+
+	InternalServiceTimeoutError = `{"errorCode":"InternalServiceTimeoutError","errorMessage":"Internal service timeout"}`
+)
+
+//NewRequestContext limits handler context by request timeout and lambda deadline minus safety margin
+func NewRequestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := DefaultRequestTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) - ResponseSafetyMargin; left < timeout {
+			timeout = left
+		}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+//InternalCallTimeout is the budget of the function, new faces and discover keep DefaultInternalCallTimeout,
+//they select profiles on the fly
+func InternalCallTimeout(functionName string) time.Duration {
+	settings := Settings()
+	switch functionName {
+	case settings.PrepareNewFacesFunctionName:
+		//async invocation only puts event into the queue
+		return asyncInternalCallTimeout
+	case settings.InternalAuthFunctionName:
+		return authInternalCallTimeout
+	case settings.GetLcLikesFunctionName, settings.GetLcMessagesFunctionName, settings.LikesYouFunctionName,
+		settings.MatchesFunctionName, settings.MessagesFunctionName, settings.LMHISFunctionName, settings.ChatFunctionName:
+		return sectionInternalCallTimeout
+	}
+	return DefaultInternalCallTimeout
+}
+
+//error string which should be returned to client when internal call with ctx failed
+func internalCallErrorStr(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return InternalServiceTimeoutError
+	}
+	return commons.InternalServerError
+}
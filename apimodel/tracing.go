@@ -0,0 +1,108 @@
+package apimodel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"time"
+)
+
+const (
+	TracingExporterNone = "none"
+	TracingExporterOTLP = "otlp"
+	TracingExporterFile = "file"
+
+	tracerName = "feeds"
+	//lambda can be frozen right after the response, so spans are flushed before it
+	tracingFlushTimeout = time.Second
+)
+
+//tracerProvider is nil when tracing is disabled, global otel provider is a noop then
+var tracerProvider *sdktrace.TracerProvider
+
+//InitTracing registers global tracer provider with exporter selected by TRACING_EXPORTER
+func InitTracing(config Config, lambdaName string) error {
+	var exporter sdktrace.SpanExporter
+	switch config.TracingExporter {
+	case TracingExporterOTLP:
+		otlpExporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return fmt.Errorf("error creating otlp trace exporter : %v", err)
+		}
+		exporter = otlpExporter
+	case TracingExporterFile:
+		out := os.Stdout
+		if len(config.TracingFile) != 0 {
+			file, err := os.OpenFile(config.TracingFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return fmt.Errorf("error opening tracing file [%s] : %v", config.TracingFile, err)
+			}
+			out = file
+		}
+		fileExporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			return fmt.Errorf("error creating file trace exporter : %v", err)
+		}
+		exporter = fileExporter
+	default:
+		return nil
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", fmt.Sprintf("%s-%s", config.Env, lambdaName)))
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	return nil
+}
+
+//StartSpan starts child span of the span from ctx
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+//EndSpan marks span as failed when call was not ok and ends it
+func EndSpan(span trace.Span, ok bool, errStr string) {
+	if !ok {
+		span.SetStatus(codes.Error, errStr)
+	}
+	span.End()
+}
+
+//StartRequestSpan starts root span of the handler
+func StartRequestSpan(ctx context.Context, endpoint string, lc *lambdacontext.LambdaContext) (context.Context, trace.Span) {
+	return StartSpan(ctx, endpoint, attribute.String("endpoint", endpoint), attribute.String(RequestIdKey, RequestId(lc)))
+}
+
+//FinishRequestSpan ends root span and flushes all spans of the request
+func FinishRequestSpan(span trace.Span) {
+	span.End()
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		Anlogger.Warnf(nil, "tracing.go : error flushing spans : %v", err)
+	}
+}
+
+//MarshalResponse marshals response object into json inside own span
+func MarshalResponse(ctx context.Context, resp interface{}) ([]byte, error) {
+	_, span := StartSpan(ctx, "marshal response")
+	body, err := json.Marshal(resp)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("bytes", len(body)))
+	span.End()
+	return body, err
+}
@@ -0,0 +1,176 @@
+package apimodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ringoid/commons"
+	"strconv"
+	"strings"
+)
+
+const (
+	//source of the request which is not a feed
+	ProfileSource = "profile"
+)
+
+//ClientError is error envelope returned to the client. ErrorCode and ErrorMessage are the same fields as in commons
+//error strings, so clients which check only errorCode keep working. Field is the wrong param, RetryAfterSec is
+//a hint when the request can be repeated.
+type ClientError struct {
+	ErrorCode     string `json:"errorCode"`
+	ErrorMessage  string `json:"errorMessage"`
+	Field         string `json:"field,omitempty"`
+	RetryAfterSec int64  `json:"retryAfterSec,omitempty"`
+}
+
+func (e ClientError) String() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return commons.InternalServerError
+	}
+	return string(data)
+}
+
+//errorCode of commons.WrongRequestParamsClientError, so structured errors have the same code
+var wrongParamsErrorCode = errorCodeOf(commons.WrongRequestParamsClientError)
+
+func errorCodeOf(errStr string) string {
+	var clientError ClientError
+	json.Unmarshal([]byte(errStr), &clientError)
+	return clientError.ErrorCode
+}
+
+//WrongParamError is commons.WrongRequestParamsClientError which tells the client what is wrong with the param
+func WrongParamError(field, message string) string {
+	return ClientError{ErrorCode: wrongParamsErrorCode, ErrorMessage: message, Field: field}.String()
+}
+
+//IsValidSource is true for feed names and profile
+func IsValidSource(source string) bool {
+	_, ok := commons.FeedNames[source]
+	return ok || source == ProfileSource
+}
+
+//ParamsValidator reads query string params or checks fields of already unmarshaled json body (...Field methods)
+//and collects problems, the first one is returned to the client
+type ParamsValidator struct {
+	params   map[string]string
+	problems []ClientError
+}
+
+//NewParamsValidator of query string params, params are nil when only fields of the body are checked
+func NewParamsValidator(params map[string]string) *ParamsValidator {
+	return &ParamsValidator{params: params}
+}
+
+//Invalid adds the problem of the field
+func (v *ParamsValidator) Invalid(field, message string) {
+	v.problems = append(v.problems, ClientError{ErrorCode: wrongParamsErrorCode, ErrorMessage: message, Field: field})
+}
+
+func (v *ParamsValidator) Required(name string) string {
+	value, ok := v.params[name]
+	if !ok {
+		v.Invalid(name, fmt.Sprintf("%s is required", name))
+	}
+	return value
+}
+
+func (v *ParamsValidator) RequiredNonNegativeInt64(name string) int64 {
+	value, ok := v.params[name]
+	if !ok {
+		v.Invalid(name, fmt.Sprintf("%s is required", name))
+		return 0
+	}
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || result < 0 {
+		v.Invalid(name, fmt.Sprintf("%s should be a non-negative integer", name))
+		return 0
+	}
+	return result
+}
+
+//OptionalInt returns defaultValue when param is absent or empty
+func (v *ParamsValidator) OptionalInt(name string, defaultValue int) int {
+	value := v.params[name]
+	if len(value) == 0 {
+		return defaultValue
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		v.Invalid(name, fmt.Sprintf("%s should be an integer", name))
+		return defaultValue
+	}
+	return result
+}
+
+//OptionalSource returns source if it is present, it should be a feed name or profile
+func (v *ParamsValidator) OptionalSource(name string) string {
+	value, ok := v.params[name]
+	if ok && !IsValidSource(value) {
+		v.Invalid(name, fmt.Sprintf("%s has unsupported value", name))
+	}
+	return value
+}
+
+//RequiredStringField should be present and not empty
+func (v *ParamsValidator) RequiredStringField(name string, value *string) string {
+	if value == nil || len(*value) == 0 {
+		v.Invalid(name, fmt.Sprintf("%s is required", name))
+		return ""
+	}
+	return *value
+}
+
+func (v *ParamsValidator) RequiredNonNegativeInt64Field(name string, value *int64) int64 {
+	if value == nil || *value < 0 {
+		v.Invalid(name, fmt.Sprintf("%s should be a non-negative integer", name))
+		return 0
+	}
+	return *value
+}
+
+//RequiredSourceField should be a feed name or profile
+func (v *ParamsValidator) RequiredSourceField(name string, value *string) string {
+	if value == nil {
+		v.Invalid(name, fmt.Sprintf("%s is required", name))
+		return ""
+	}
+	if !IsValidSource(*value) {
+		v.Invalid(name, fmt.Sprintf("%s has unsupported value", name))
+	}
+	return *value
+}
+
+//OptionalPositiveIntField returns defaultValue when field is absent
+func (v *ParamsValidator) OptionalPositiveIntField(name string, value *int, defaultValue int) int {
+	if value == nil {
+		return defaultValue
+	}
+	if *value <= 0 {
+		v.Invalid(name, fmt.Sprintf("%s should be positive", name))
+		return defaultValue
+	}
+	return *value
+}
+
+func (v *ParamsValidator) Ok() bool {
+	return len(v.problems) == 0
+}
+
+//ErrStr is error string of the first problem
+func (v *ParamsValidator) ErrStr() string {
+	if v.Ok() {
+		return ""
+	}
+	return v.problems[0].String()
+}
+
+//String lists all problems for the log
+func (v *ParamsValidator) String() string {
+	problems := make([]string, 0, len(v.problems))
+	for _, each := range v.problems {
+		problems = append(problems, fmt.Sprintf("%s : %s", each.Field, each.ErrorMessage))
+	}
+	return strings.Join(problems, ", ")
+}
@@ -1,16 +1,13 @@
-package main
+package discover
 
 import (
 	"../apimodel"
-	basicLambda "github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/events"
 	"context"
 	"strings"
 	"github.com/ringoid/commons"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"encoding/json"
-	"github.com/aws/aws-sdk-go/service/lambda"
-	"github.com/aws/aws-sdk-go/aws"
 )
 
 const (
@@ -18,12 +15,12 @@ const (
 	newFacesMaxLimit     = 100
 )
 
-func init() {
-	apimodel.InitLambdaVars("discover-feed")
-}
-
-func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+func Handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	lc, _ := lambdacontext.FromContext(ctx)
+	lc = apimodel.WithRequestId(lc, apimodel.RequestIdFromHeaders(request.Headers))
+
+	ctx, cancel := apimodel.NewRequestContext(ctx)
+	defer cancel()
 
 	start := commons.UnixTimeInMillis()
 
@@ -35,11 +32,20 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	if request.HTTPMethod != "POST" {
 		return commons.NewWrongHttpMethodServiceResponse(), nil
 	}
+
+	ctx, span := apimodel.StartRequestSpan(ctx, "discover", lc)
+	defer apimodel.DrainCommonsLogs(lc)
+	defer apimodel.FinishRequestSpan(span)
+	defer apimodel.FinishRequestMetrics("discover", start)
 	sourceIp := request.Headers["x-forwarded-for"]
+	if ok, errStr := apimodel.Limiter.AllowIp("discover", sourceIp, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "discover.go : return %s to client", errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
 
 	apimodel.Anlogger.Debugf(lc, "discover.go : start handle request %v", request)
 
-	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.Anlogger, lc)
+	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.CommonsLogger, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "discover.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
@@ -51,17 +57,22 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, *reqParam.AccessToken,
-		apimodel.InternalAuthFunctionName, apimodel.ClientLambda, apimodel.Anlogger, lc)
+	userId, ok, errStr := apimodel.Backend.VerifyAccessToken(ctx, appVersion, isItAndroid, *reqParam.AccessToken, lc)
 
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "discover.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
+	if ok, errStr := apimodel.Limiter.AllowUser("discover", userId, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "discover.go : userId [%s], return %s to client", userId, errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
+
 	reqParam.UserId = &userId
+	distanceUnit := apimodel.DistanceUnitFromBody(request.Body, request.Headers, lc)
 
-	internalNewFaces, repeatRequestAfter, _, ok, errStr := discover(reqParam, lc)
+	internalNewFaces, repeatRequestAfter, _, ok, errStr := discover(ctx, reqParam, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "discover.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
@@ -73,62 +84,10 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 		feedResp.RepeatRequestAfter = repeatRequestAfter
 	}
 
-	targetIds := make([]string, 0)
-
-	profiles := make([]commons.Profile, 0)
-	for _, each := range internalNewFaces {
-
-		photos := make([]commons.Photo, 0)
-
-		for _, eachPhoto := range each.Photos {
-			photos = append(photos, commons.Photo{
-				PhotoId:           eachPhoto.ResizedPhotoId,
-				PhotoUri:          commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.Link, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-				ThumbnailPhotoUri: commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.ThumbnailLink, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-			})
-		}
-
-		if len(photos) == 0 {
-			apimodel.Anlogger.Warnf(lc, "discover.go : discover return user [%s] with empty photo list for resolution [%s] for userId [%s]",
-				each.UserId, *reqParam.Resolution, userId)
-			continue
-		}
-
-		lastOnlineText, lastOnlineFlag := apimodel.TransformLastOnlineTimeIntoStatusText(userId, each.LastOnlineTime, each.SourceLocale, lc)
-		distanceText := apimodel.TransformDistanceInDistanceText(userId, each, lc)
-
-		profile := commons.Profile{
-			UserId:         each.UserId,
-			Photos:         photos,
-			LastOnlineText: lastOnlineText,
-			LastOnlineFlag: lastOnlineFlag,
-			DistanceText:   distanceText,
-			Age:            each.Age,
-			Sex:            each.Sex,
-			Property:       each.Property,
-			Transport:      each.Transport,
-			Income:         each.Income,
-			Height:         each.Height,
-			EducationLevel: each.EducationLevel,
-			HairColor:      each.HairColor,
-			Children:       each.Children,
-			Name:           each.Name,
-			JobTitle:       each.JobTitle,
-			Company:        each.Company,
-			EducationText:  each.EducationText,
-			About:          each.About,
-			Instagram:      each.Instagram,
-			TikTok:         each.TikTok,
-			WhereLive:      each.WhereLive,
-			WhereFrom:      each.WhereFrom,
-			StatusText:     each.StatusText,
-			TotalLikes:     each.TotalLikes,
-		}
-
-		profile = apimodel.CheckProfileBeforeResponse(userId, profile)
-
-		profiles = append(profiles, profile)
+	profiles := apimodel.MapProfiles(ctx, userId, *reqParam.Resolution, internalNewFaces, apimodel.ProfileMapOptions{DistanceUnit: distanceUnit, Viewer: apimodel.FlagContext{UserId: userId, AppVersion: appVersion, IsItAndroid: isItAndroid}}, lc)
 
+	targetIds := make([]string, 0)
+	for _, each := range profiles {
 		targetIds = append(targetIds, each.UserId)
 	}
 	apimodel.Anlogger.Debugf(lc, "discover.go : prepare [%d] discover profiles for userId [%s]", len(profiles), userId)
@@ -142,7 +101,7 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 
 	apimodel.MarkNewFacesDefaultSort(userId, &feedResp, lc)
 
-	body, err := json.Marshal(feedResp)
+	body, err := apimodel.MarshalResponse(ctx, feedResp)
 	if err != nil {
 		apimodel.Anlogger.Errorf(lc, "discover.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
 		apimodel.Anlogger.Errorf(lc, "discover.go : userId [%s], return %s to client", userId, commons.InternalServerError)
@@ -161,10 +120,13 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 
 	execTime := commons.UnixTimeInMillis() - start
 	event := commons.NewProfileWasReturnToDiscoverEvent(userId, sourceIp, len(targetIds), minA, maxA, maxD, feedResp.RepeatRequestAfter, execTime)
-	commons.SendAnalyticEvent(event, userId, apimodel.DeliveryStreamName, apimodel.AwsDeliveryStreamClient, apimodel.Anlogger, lc)
+	apimodel.SendAnalyticEvent(event, userId, lc)
+	apimodel.Metrics.ProfilesReturned("discover", apimodel.NewFacesSection, len(feedResp.Profiles))
 
-	apimodel.Anlogger.Infof(lc, "discover.go : successfully return repeat request after [%v], [%d] new faces profiles to userId [%s], minAge [%d], maxAge [%d], maxDistance [%d], duration [%v]",
-		feedResp.RepeatRequestAfter, len(feedResp.Profiles), userId, minA, maxA, maxD, execTime)
+	apimodel.Anlogger.WithFields(apimodel.Fields{"endpoint": "discover", "userId": userId, "durationMs": execTime,
+		"profiles": len(feedResp.Profiles)}).
+		Infof(lc, "discover.go : successfully return repeat request after [%v], [%d] new faces profiles to userId [%s], minAge [%d], maxAge [%d], maxDistance [%d], duration [%v]",
+			feedResp.RepeatRequestAfter, len(feedResp.Profiles), userId, minA, maxA, maxD, execTime)
 	//apimodel.Anlogger.Debugf(lc, "discover.go : return successful resp [%s] for userId [%s]", string(body), userId)
 	return commons.NewServiceResponse(string(body)), nil
 }
@@ -179,14 +141,13 @@ func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.Disco
 		return nil, false, commons.InternalServerError
 	}
 
-	if req.AccessToken == nil || len(*req.AccessToken) == 0 {
-		apimodel.Anlogger.Errorf(lc, "discover.go : accessToken is empty, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
-	if req.Resolution == nil || len(*req.Resolution) == 0 {
-		apimodel.Anlogger.Errorf(lc, "discover.go : resolution is empty, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
+	validator := apimodel.NewParamsValidator(nil)
+	validator.RequiredStringField("accessToken", req.AccessToken)
+	validator.RequiredStringField("resolution", req.Resolution)
+	validator.RequiredNonNegativeInt64Field("lastActionTime", req.LastActionTime)
+	if !validator.Ok() {
+		apimodel.Anlogger.Errorf(lc, "discover.go : wrong request params [%s], request [%v]", validator.String(), req)
+		return nil, false, validator.ErrStr()
 	}
 
 	if !commons.AllowedPhotoResolution[*req.Resolution] {
@@ -194,11 +155,6 @@ func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.Disco
 		req.Resolution = &commons.BiggestDefaultPhotoResolution
 	}
 
-	if req.LastActionTime == nil || *req.LastActionTime < 0 {
-		apimodel.Anlogger.Errorf(lc, "discover.go : lastActionTime is empty or less than zero, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
 	if req.Filter != nil {
 
 		if req.Filter.MinAge != nil {
@@ -263,43 +219,20 @@ func filterString(req *commons.DiscoverRequest) (int, int, int) {
 	return minA, maxA, maxD
 }
 
-func main() {
-	basicLambda.Start(handler)
-}
-
 //response, repeat request after sec, how much prepared we have now, ok and error string
-func discover(request *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) ([]commons.InternalProfiles, int64, int64, bool, string) {
+func discover(ctx context.Context, request *commons.DiscoverRequest, lc *lambdacontext.LambdaContext) ([]commons.InternalProfiles, int64, int64, bool, string) {
 
 	apimodel.Anlogger.Debugf(lc, "discover.go : discover for userId [%s] with limit [%d]", *request.UserId, *request.Limit)
 
-	jsonBody, err := json.Marshal(request)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "discover.go : error marshaling req %s into json for userId [%s] : %v", request, *request.UserId, err)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(apimodel.DiscoverFunctionName), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "discover.go : error invoke function [%s] with body %s for userId [%s] : %v", apimodel.DiscoverFunctionName, jsonBody, *request.UserId, err)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "discover.go : status code = %d, response body %s for request %s, for userId [%s] ", *resp.StatusCode, string(resp.Payload), jsonBody, *request.UserId)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	var response commons.InternalGetNewFacesResp
-	err = json.Unmarshal(resp.Payload, &response)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "discover.go : error unmarshaling response %s into json for userId [%s] : %v", string(resp.Payload), *request.UserId, err)
-		return nil, 0, 0, false, commons.InternalServerError
+	response, ok, errStr := apimodel.Backend.Discover(ctx, request, lc)
+	if !ok {
+		return nil, 0, 0, false, errStr
 	}
 
 	if *request.LastActionTime > response.LastActionTime {
 		apimodel.Anlogger.Debugf(lc, "discover.go : requested lastActionTime [%d] > actual lastActionTime [%d] for userId [%s], diff is [%d]",
 			*request.LastActionTime, response.LastActionTime, *request.UserId, response.LastActionTime - *request.LastActionTime)
-		return nil, apimodel.DefaultRepeatTimeSec, 0, true, ""
+		return nil, apimodel.Polling.RepeatRequestAfter(*request.LastActionTime - response.LastActionTime), 0, true, ""
 	}
 
 	//apimodel.Anlogger.Debugf(lc, "discover.go : successfully got profiles for userId [%s] with limit [%d], resp %v", *request.UserId, *request.Limit, response)
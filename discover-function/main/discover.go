@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../discover-function"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("discover-feed")
+}
+
+func main() {
+	basicLambda.Start(discover.Handler)
+}
@@ -1,58 +1,38 @@
-package main
+package getlc
 
 import (
 	"../apimodel"
-	basicLambda "github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/events"
 	"context"
 	"strings"
 	"github.com/ringoid/commons"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"encoding/json"
-	"github.com/aws/aws-sdk-go/service/lambda"
-	"github.com/aws/aws-sdk-go/aws"
 	"sync"
 )
 
 const (
 	getLcEachFeedMaxLimit = 150
+	//internal functions return profiles from the beginning, so the deepest page is limited
+	getLcMaxInternalLimit = 3000
 )
 
-func init() {
-	apimodel.InitLambdaVars("get-lc-feed")
+//page of one section, internal function is asked for offset+size profiles. The page starts after
+//the profile lastUserId, offset is used when there is no such profile anymore.
+type lcPage struct {
+	offset     int
+	size       int
+	lastUserId string
 }
 
-func getLc(request *commons.GetLCRequest, functionName string, lc *lambdacontext.LambdaContext) (*commons.InternalGetLCResp, bool, string) {
+func getLc(ctx context.Context, request *commons.GetLCRequest, functionName string, lc *lambdacontext.LambdaContext) (*commons.InternalGetLCResp, bool, string) {
 
 	apimodel.Anlogger.Debugf(lc, "get_lc.go : get lc (function name %s) you for userId [%s]",
 		functionName, *request.UserId)
 
-	jsonBody, err := json.Marshal(request)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : error marshaling req %s into json for userId [%s] (function name %s) : %v",
-			request, *request.UserId, functionName, err)
-		return nil, false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(functionName), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : error invoke function [%s] with body %s for userId [%s] : %v",
-			functionName, jsonBody, *request.UserId, err)
-		return nil, false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : status code = %d, response body %s for request %s, for userId [%s] (function name %s",
-			*resp.StatusCode, string(resp.Payload), jsonBody, *request.UserId, functionName)
-		return nil, false, commons.InternalServerError
-	}
-
-	var response commons.InternalGetLCResp
-	err = json.Unmarshal(resp.Payload, &response)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : error unmarshaling response %s into json for userId [%s] (function name %s) : %v",
-			string(resp.Payload), request.UserId, functionName, err)
-		return nil, false, commons.InternalServerError
+	response, ok, errStr := apimodel.Backend.GetLC(ctx, functionName, request, lc)
+	if !ok {
+		return nil, false, errStr
 	}
 
 	//apimodel.Anlogger.Debugf(lc, "get_lc.go : successfully got profiles for userId [%s] (function name %s), resp %v",
@@ -66,93 +46,49 @@ type TmpResult struct {
 	ErrorStr      string
 }
 
-func handleJob(request *commons.GetLCRequest, isItLikes bool,
+func handleJob(fanOut *apimodel.FanOut, request *commons.GetLCRequest, page lcPage, mapOpts apimodel.ProfileMapOptions, isItLikes bool,
 	innerResult *TmpResult,
 	wg *sync.WaitGroup, lc *lambdacontext.LambdaContext) {
 
 	defer wg.Done()
 
-	functionName := apimodel.GetLcMessagesFunctionName
+	functionName := apimodel.Settings().GetLcMessagesFunctionName
 	if isItLikes {
-		functionName = apimodel.GetLcLikesFunctionName
+		functionName = apimodel.Settings().GetLcLikesFunctionName
 	}
 
-	internalGetLcResponse, ok, errStr := getLc(request, functionName, lc)
+	//both jobs share the request, so each one asks with own limit
+	internalRequest := *request
+	limit := page.offset + page.size
+	if limit > getLcMaxInternalLimit {
+		limit = getLcMaxInternalLimit
+	}
+	internalRequest.Limit = &limit
+
+	internalGetLcResponse, ok, errStr := getLc(fanOut.Context(), &internalRequest, functionName, lc)
 	if !ok {
 		innerResult.Ok = ok
 		innerResult.ErrorStr = errStr
+		fanOut.Fail(errStr)
 		return
 	}
 
 	if *request.LastActionTime > internalGetLcResponse.LastActionTime {
 		innerResult.Ok = true
-		innerResult.GetLcFeedResp.RepeatRequestAfter = apimodel.DefaultRepeatTimeSec
+		innerResult.GetLcFeedResp.RepeatRequestAfter = apimodel.Polling.RepeatRequestAfter(*request.LastActionTime - internalGetLcResponse.LastActionTime)
 		apimodel.Anlogger.Debugf(lc, "get_lc.go : (%s) requested lastAction time [%v] > actual last actionTime [%v], diff [%v]",
 			functionName, *request.LastActionTime, internalGetLcResponse.LastActionTime, internalGetLcResponse.LastActionTime - *request.LastActionTime)
 		return
 	}
 
-	profiles := make([]commons.Profile, 0)
-	for _, each := range internalGetLcResponse.Profiles {
-
-		photos := make([]commons.Photo, 0)
-
-		for _, eachPhoto := range each.Photos {
-			photos = append(photos, commons.Photo{
-				PhotoId:           eachPhoto.ResizedPhotoId,
-				PhotoUri:          commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.Link, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-				ThumbnailPhotoUri: commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.ThumbnailLink, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-			})
-		}
-
-		messages := make([]commons.Message, 0)
-		for _, eachMessage := range each.Messages {
-			messages = append(messages, eachMessage)
-		}
-
-		if len(photos) == 0 {
-			apimodel.Anlogger.Warnf(lc, "get_lc.go : lc return user [%s] with empty photo list for resolution [%s] for userId [%s]",
-				each.UserId, *request.Resolution, *request.UserId)
-			continue
-		}
-
-		lastOnlineText, lastOnlineFlag := apimodel.TransformLastOnlineTimeIntoStatusText(*request.UserId, each.LastOnlineTime, each.SourceLocale, lc)
-		distanceText := apimodel.TransformDistanceInDistanceText(*request.UserId, each, lc)
-
-		profile := commons.Profile{
-			UserId:         each.UserId,
-			Photos:         photos,
-			Unseen:         each.Unseen,
-			Messages:       messages,
-			LastOnlineText: lastOnlineText,
-			LastOnlineFlag: lastOnlineFlag,
-			DistanceText:   distanceText,
-			Age:            each.Age,
-			Sex:            each.Sex,
-			Property:       each.Property,
-			Transport:      each.Transport,
-			Income:         each.Income,
-			Height:         each.Height,
-			EducationLevel: each.EducationLevel,
-			HairColor:      each.HairColor,
-			Children:       each.Children,
-			Name:           each.Name,
-			JobTitle:       each.JobTitle,
-			Company:        each.Company,
-			EducationText:  each.EducationText,
-			About:          each.About,
-			Instagram:      each.Instagram,
-			TikTok:         each.TikTok,
-			WhereLive:      each.WhereLive,
-			WhereFrom:      each.WhereFrom,
-			StatusText:     each.StatusText,
-			TotalLikes:     each.TotalLikes,
-		}
-
-		profile = apimodel.CheckProfileBeforeResponse(*request.UserId, profile)
-
-		profiles = append(profiles, profile)
+	pageProfiles, nextCursor, truncated := cutPage(internalGetLcResponse, page, isItLikes)
+	if truncated {
+		apimodel.Anlogger.Warnf(lc, "get_lc.go : (%s) [%d] profiles are more than can be paged through, section is truncated for userId [%s]",
+			functionName, internalGetLcResponse.AllProfilesNum, *request.UserId)
 	}
+	mapOpts.UnseenFromInternal = true
+	mapOpts.IncludeMessages = true
+	profiles := apimodel.MapProfiles(fanOut.Context(), *request.UserId, *request.Resolution, pageProfiles, mapOpts, lc)
 	apimodel.Anlogger.Debugf(lc, "get_lc.go : prepare [%d] lc profiles for userId [%s]", len(profiles), *request.UserId)
 
 	innerResult.Ok = true
@@ -160,17 +96,58 @@ func handleJob(request *commons.GetLCRequest, isItLikes bool,
 	if isItLikes {
 		innerResult.GetLcFeedResp.LikesYou = profiles
 		innerResult.GetLcFeedResp.AllLikesYouProfilesNum = internalGetLcResponse.AllProfilesNum
+		innerResult.GetLcFeedResp.LikesYouNextCursor = nextCursor
+		innerResult.GetLcFeedResp.LikesYouTruncated = truncated
 		apimodel.Anlogger.Debugf(lc, "get_lc.go : set all likes you profile num to [%d] for userId [%s]", innerResult.GetLcFeedResp.AllLikesYouProfilesNum)
 	} else {
 		innerResult.GetLcFeedResp.Messages = profiles
 		innerResult.GetLcFeedResp.AllMessagesProfilesNum = internalGetLcResponse.AllProfilesNum
+		innerResult.GetLcFeedResp.MessagesNextCursor = nextCursor
+		innerResult.GetLcFeedResp.MessagesTruncated = truncated
 		apimodel.Anlogger.Debugf(lc, "get_lc.go : set all messages/matches num to [%d] for userId [%s]", innerResult.GetLcFeedResp.AllMessagesProfilesNum)
 	}
 	return
 }
 
-func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+//profiles of the page, cursor of the next one and whether the section is truncated. Cursor is empty
+//if there is nothing more or the rest is deeper than getLcMaxInternalLimit.
+func cutPage(resp *commons.InternalGetLCResp, page lcPage, isItLikes bool) ([]commons.InternalProfiles, string, bool) {
+	start := page.offset
+	if len(page.lastUserId) != 0 {
+		for i, each := range resp.Profiles {
+			if each.UserId == page.lastUserId {
+				start = i + 1
+				break
+			}
+		}
+	}
+	if start >= len(resp.Profiles) {
+		return make([]commons.InternalProfiles, 0), "", false
+	}
+	end := start + page.size
+	if end > len(resp.Profiles) {
+		end = len(resp.Profiles)
+	}
+	if end >= len(resp.Profiles) && end >= resp.AllProfilesNum {
+		return resp.Profiles[start:end], "", false
+	}
+	if end >= getLcMaxInternalLimit {
+		return resp.Profiles[start:end], "", true
+	}
+	section := apimodel.MessagesSection
+	if isItLikes {
+		section = apimodel.LikesYouSection
+	}
+	nextCursor := apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: section, Offset: end, LastUserId: resp.Profiles[end-1].UserId})
+	return resp.Profiles[start:end], nextCursor, false
+}
+
+func Handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	lc, _ := lambdacontext.FromContext(ctx)
+	lc = apimodel.WithRequestId(lc, apimodel.RequestIdFromHeaders(request.Headers))
+
+	ctx, cancel := apimodel.NewRequestContext(ctx)
+	defer cancel()
 
 	startTime := commons.UnixTimeInMillis()
 
@@ -182,113 +159,175 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	if request.HTTPMethod != "POST" {
 		return commons.NewWrongHttpMethodServiceResponse(), nil
 	}
+
+	ctx, span := apimodel.StartRequestSpan(ctx, "get_lc", lc)
+	defer apimodel.DrainCommonsLogs(lc)
+	defer apimodel.FinishRequestSpan(span)
+	defer apimodel.FinishRequestMetrics("get_lc", startTime)
 	sourceIp := request.Headers["x-forwarded-for"]
+	if ok, errStr := apimodel.Limiter.AllowIp("get_lc", sourceIp, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : return %s to client", errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
 
 	apimodel.Anlogger.Debugf(lc, "get_lc.go : start handle request %v", request)
 
-	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.Anlogger, lc)
+	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.CommonsLogger, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_lc.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	reqParam, ok, errStr := parseParams(request.Body, lc)
+	reqParam, likesYouPage, messagesPage, ok, errStr := parseParams(request.Body, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_lc.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	//todo:set hardcoded limit
-
-	userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, *reqParam.AccessToken,
-		apimodel.InternalAuthFunctionName, apimodel.ClientLambda, apimodel.Anlogger, lc)
+	userId, ok, errStr := apimodel.Backend.VerifyAccessToken(ctx, appVersion, isItAndroid, *reqParam.AccessToken, lc)
 
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_lc.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
+	if ok, errStr := apimodel.Limiter.AllowUser("get_lc", userId, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
+
 	reqParam.UserId = &userId
+	mapOpts := apimodel.ProfileMapOptions{
+		DistanceUnit: apimodel.DistanceUnitFromBody(request.Body, request.Headers, lc),
+		Viewer:       apimodel.FlagContext{UserId: userId, AppVersion: appVersion, IsItAndroid: isItAndroid},
+	}
+
+	filter, _ := json.Marshal(reqParam.Filter)
+	key := apimodel.CoalesceKey{Endpoint: "get_lc", UserId: userId, LastActionTime: *reqParam.LastActionTime, Resolution: *reqParam.Resolution,
+		Filter: apimodel.CoalesceFilter(string(filter), likesYouPage.offset, likesYouPage.size, likesYouPage.lastUserId,
+			messagesPage.offset, messagesPage.size, messagesPage.lastUserId,
+			mapOpts.DistanceUnit, appVersion, isItAndroid)}
+	result, ok, errStr, fresh := apimodel.Coalescing.Do(ctx, key, func(ctx context.Context) (interface{}, bool, string) {
+		return buildFeed(ctx, userId, reqParam, likesYouPage, messagesPage, mapOpts, lc)
+	}, lc)
+	if !ok {
+		//degraded mode, the last good feed is better than an error
+		staleResp := &apimodel.GetLcFeedResp{}
+		if !apimodel.IsBackendError(errStr) || !apimodel.Fallback.Recall(key, staleResp, lc) {
+			return commons.NewServiceResponse(errStr), nil
+		}
+		apimodel.Anlogger.Warnf(lc, "get_lc.go : internal functions failed with %s, return the last good feed to userId [%s]", errStr, userId)
+		result, fresh = staleResp, false
+	}
+	feedResp := result.(*apimodel.GetLcFeedResp)
+	complete := fresh && feedResp.RepeatRequestAfter == 0
+	if complete {
+		apimodel.Coalescing.Remember(key, feedResp)
+	}
+
+	//todo:delete after all
+	//apimodel.MarkLCAllMessagesHaveBeenRead(&feedResp, lc)
 
+	body, err := apimodel.MarshalResponse(ctx, feedResp)
+	if err != nil {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, commons.InternalServerError)
+		return commons.NewServiceResponse(commons.InternalServerError), nil
+	}
+	if complete {
+		apimodel.Fallback.Remember(key, body, lc)
+	}
+
+	event := commons.NewProfileWasReturnToLCEvent(userId, sourceIp, *reqParam.Source, len(feedResp.LikesYou), len(feedResp.Messages), feedResp.RepeatRequestAfter)
+	apimodel.SendAnalyticEvent(event, userId, lc)
+
+	apimodel.Metrics.ProfilesReturned("get_lc", apimodel.LikesYouSection, len(feedResp.LikesYou))
+	apimodel.Metrics.ProfilesReturned("get_lc", apimodel.MessagesSection, len(feedResp.Messages))
+
+	finishTime := commons.UnixTimeInMillis()
+	apimodel.Anlogger.WithFields(apimodel.Fields{"endpoint": "get_lc", "userId": userId, "durationMs": finishTime - startTime,
+		"likesYou": len(feedResp.LikesYou), "messages": len(feedResp.Messages)}).
+		Infof(lc, "get_lc.go : successfully return repeat request after [%v], [%d] likes you profiles and [%d] messages to userId [%s], duration [%v]", feedResp.RepeatRequestAfter, len(feedResp.LikesYou), len(feedResp.Messages), userId, finishTime-startTime)
+	//apimodel.Anlogger.Debugf(lc, "get_lc.go : return successful resp [%s] for userId [%s]", string(body), userId)
+	return commons.NewServiceResponse(string(body)), nil
+}
+
+//buildFeed fans out to internal functions and builds the response, ok and error string
+func buildFeed(ctx context.Context, userId string, reqParam *commons.GetLCRequest, likesYouPage, messagesPage lcPage, mapOpts apimodel.ProfileMapOptions,
+	lc *lambdacontext.LambdaContext) (*apimodel.GetLcFeedResp, bool, string) {
 	//prepare response
-	feedResp := apimodel.GetLcFeedResp{}
+	feedResp := &apimodel.GetLcFeedResp{}
 	feedResp.LikesYou = make([]commons.Profile, 0)
 	feedResp.Messages = make([]commons.Profile, 0)
 
+	//there is no sense to wait for the second part if the first one failed
+	fanOut := apimodel.NewFanOut(ctx, true)
+	defer fanOut.Cancel()
+
 	var commonWaitGroup sync.WaitGroup
 
 	//likes you
 	commonWaitGroup.Add(1)
 	likeYouTmpResult := TmpResult{GetLcFeedResp: &apimodel.GetLcFeedResp{}}
-	go handleJob(reqParam, true, &likeYouTmpResult, &commonWaitGroup, lc)
+	go handleJob(fanOut, reqParam, likesYouPage, mapOpts, true, &likeYouTmpResult, &commonWaitGroup, lc)
 
 	//messages
 	commonWaitGroup.Add(1)
 	messagesTmpResult := TmpResult{GetLcFeedResp: &apimodel.GetLcFeedResp{}}
-	go handleJob(reqParam, false, &messagesTmpResult, &commonWaitGroup, lc)
+	go handleJob(fanOut, reqParam, messagesPage, mapOpts, false, &messagesTmpResult, &commonWaitGroup, lc)
 
 	commonWaitGroup.Wait()
 
-	if !likeYouTmpResult.Ok {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, likeYouTmpResult.ErrorStr)
-		return commons.NewServiceResponse(likeYouTmpResult.ErrorStr), nil
-	}
-	if !messagesTmpResult.Ok {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, messagesTmpResult.ErrorStr)
-		return commons.NewServiceResponse(messagesTmpResult.ErrorStr), nil
+	if errStr := fanOut.ErrStr(); len(errStr) != 0 {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, errStr)
+		return nil, false, errStr
 	}
 
-	if likeYouTmpResult.GetLcFeedResp.RepeatRequestAfter != 0 || messagesTmpResult.GetLcFeedResp.RepeatRequestAfter != 0 {
-		apimodel.Anlogger.Debugf(lc, "get_lc.go : return repeat request after [%v] for userId [%s]", apimodel.DefaultRepeatTimeSec, userId)
-		feedResp.RepeatRequestAfter = apimodel.DefaultRepeatTimeSec
+	repeatRequestAfter := likeYouTmpResult.GetLcFeedResp.RepeatRequestAfter
+	if messagesTmpResult.GetLcFeedResp.RepeatRequestAfter > repeatRequestAfter {
+		repeatRequestAfter = messagesTmpResult.GetLcFeedResp.RepeatRequestAfter
+	}
+	if repeatRequestAfter != 0 {
+		apimodel.Anlogger.Debugf(lc, "get_lc.go : return repeat request after [%v] for userId [%s]", repeatRequestAfter, userId)
+		feedResp.RepeatRequestAfter = repeatRequestAfter
 	} else {
 		feedResp.LikesYou = append(feedResp.LikesYou, likeYouTmpResult.GetLcFeedResp.LikesYou...)
 		feedResp.AllLikesYouProfilesNum = likeYouTmpResult.GetLcFeedResp.AllLikesYouProfilesNum
+		feedResp.LikesYouNextCursor = likeYouTmpResult.GetLcFeedResp.LikesYouNextCursor
+		feedResp.LikesYouTruncated = likeYouTmpResult.GetLcFeedResp.LikesYouTruncated
 
 		feedResp.Messages = append(feedResp.Messages, messagesTmpResult.GetLcFeedResp.Messages...)
 		feedResp.AllMessagesProfilesNum = messagesTmpResult.GetLcFeedResp.AllMessagesProfilesNum
+		feedResp.MessagesNextCursor = messagesTmpResult.GetLcFeedResp.MessagesNextCursor
+		feedResp.MessagesTruncated = messagesTmpResult.GetLcFeedResp.MessagesTruncated
 	}
 
 	//mark sorting
-	apimodel.MarkLCDefaultSort(userId, &feedResp, lc)
-
-	//todo:delete after all
-	//apimodel.MarkLCAllMessagesHaveBeenRead(&feedResp, lc)
-
-	body, err := json.Marshal(feedResp)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : userId [%s], return %s to client", userId, commons.InternalServerError)
-		return commons.NewServiceResponse(commons.InternalServerError), nil
-	}
-
-	event := commons.NewProfileWasReturnToLCEvent(userId, sourceIp, *reqParam.Source, len(feedResp.LikesYou), len(feedResp.Messages), feedResp.RepeatRequestAfter)
-	commons.SendAnalyticEvent(event, userId, apimodel.DeliveryStreamName, apimodel.AwsDeliveryStreamClient, apimodel.Anlogger, lc)
-
-	finishTime := commons.UnixTimeInMillis()
-	apimodel.Anlogger.Infof(lc, "get_lc.go : successfully return repeat request after [%v], [%d] likes you profiles and [%d] messages to userId [%s], duration [%v]", feedResp.RepeatRequestAfter, len(feedResp.LikesYou), len(feedResp.Messages), userId, finishTime-startTime)
-	//apimodel.Anlogger.Debugf(lc, "get_lc.go : return successful resp [%s] for userId [%s]", string(body), userId)
-	return commons.NewServiceResponse(string(body)), nil
+	apimodel.MarkLCDefaultSort(userId, feedResp, lc)
+	return feedResp, true, ""
 }
 
-func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.GetLCRequest, bool, string) {
+//request, likes you page, messages page, ok and error string
+func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.GetLCRequest, lcPage, lcPage, bool, string) {
 	//apimodel.Anlogger.Debugf(lc, "get_lc.go : parse request body %s", params)
 
-	var req commons.GetLCRequest
-	err := json.Unmarshal([]byte(params), &req)
+	var pageReq apimodel.GetLCRequest
+	err := json.Unmarshal([]byte(params), &pageReq)
 	if err != nil {
 		apimodel.Anlogger.Errorf(lc, "get_lc.go : error marshaling required params from the string [%s] : %v", params, err)
-		return nil, false, commons.InternalServerError
+		return nil, lcPage{}, lcPage{}, false, commons.InternalServerError
 	}
-
-	if req.AccessToken == nil || len(*req.AccessToken) == 0 {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : accessToken is empty, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
-	if req.Resolution == nil || len(*req.Resolution) == 0 {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : resolution is empty, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
+	req := pageReq.GetLCRequest
+
+	validator := apimodel.NewParamsValidator(nil)
+	validator.RequiredStringField("accessToken", req.AccessToken)
+	validator.RequiredStringField("resolution", req.Resolution)
+	validator.RequiredNonNegativeInt64Field("lastActionTime", req.LastActionTime)
+	validator.RequiredSourceField("source", req.Source)
+	pageSize := validator.OptionalPositiveIntField("pageSize", pageReq.PageSize, getLcEachFeedMaxLimit)
+	if !validator.Ok() {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : wrong request params [%s], request [%v]", validator.String(), req)
+		return nil, lcPage{}, lcPage{}, false, validator.ErrStr()
 	}
 
 	if !commons.AllowedPhotoResolution[*req.Resolution] {
@@ -296,21 +335,6 @@ func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.GetLC
 		req.Resolution = &commons.BiggestDefaultPhotoResolution
 	}
 
-	if req.LastActionTime == nil || *req.LastActionTime < 0 {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : lastActionTime is empty or less than zero, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
-	if req.Source == nil {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : source is empty, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
-	if _, ok := commons.FeedNames[*req.Source]; !ok && *req.Source != "profile" {
-		apimodel.Anlogger.Errorf(lc, "get_lc.go : source contains unsupported value, request [%v]", req)
-		return nil, false, commons.WrongRequestParamsClientError
-	}
-
 	if req.Filter != nil {
 
 		if req.Filter.MinAge != nil {
@@ -337,13 +361,33 @@ func parseParams(params string, lc *lambdacontext.LambdaContext) (*commons.GetLC
 		}
 	}
 
-	lim := getLcEachFeedMaxLimit
-	req.Limit = &lim
+	if pageSize > getLcEachFeedMaxLimit {
+		pageSize = getLcEachFeedMaxLimit
+	}
+
+	likesYouPage, ok := parsePage(apimodel.LikesYouSection, pageReq.LikesYouCursor, pageSize, lc)
+	if !ok {
+		return nil, lcPage{}, lcPage{}, false, apimodel.WrongParamError("likesYouCursor", "likesYouCursor is wrong")
+	}
+
+	messagesPage, ok := parsePage(apimodel.MessagesSection, pageReq.MessagesCursor, pageSize, lc)
+	if !ok {
+		return nil, lcPage{}, lcPage{}, false, apimodel.WrongParamError("messagesCursor", "messagesCursor is wrong")
+	}
 
 	//apimodel.Anlogger.Debugf(lc, "get_lc.go : successfully parse request [%v]", req)
-	return &req, true, ""
+	return &req, likesYouPage, messagesPage, true, ""
 }
 
-func main() {
-	basicLambda.Start(handler)
+func parsePage(section string, cursor *string, pageSize int, lc *lambdacontext.LambdaContext) (lcPage, bool) {
+	if cursor == nil || len(*cursor) == 0 {
+		return lcPage{offset: 0, size: pageSize}, true
+	}
+	//the last page starts before the limit
+	feedCursor, ok := apimodel.DecodeFeedCursor(section, *cursor, getLcMaxInternalLimit-1)
+	if !ok {
+		apimodel.Anlogger.Errorf(lc, "get_lc.go : wrong %s cursor [%s]", section, *cursor)
+		return lcPage{}, false
+	}
+	return lcPage{offset: feedCursor.Offset, size: pageSize, lastUserId: feedCursor.LastUserId}, true
 }
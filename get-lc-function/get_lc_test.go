@@ -0,0 +1,225 @@
+package getlc
+
+import (
+	"../apimodel"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ringoid/commons"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	backend := apimodel.NewFakeFeedsBackend()
+	backend.LCResp["get-lc-likes"] = commons.InternalGetLCResp{Profiles: testProfiles("u", 5), AllProfilesNum: 5}
+	backend.LCResp["get-lc-messages"] = commons.InternalGetLCResp{Profiles: testProfiles("m", 1), AllProfilesNum: 1}
+	apimodel.InitLocalVars("get-lc-function-test", backend)
+	os.Exit(m.Run())
+}
+
+func testProfiles(prefix string, num int) []commons.InternalProfiles {
+	profiles := make([]commons.InternalProfiles, 0, num)
+	for i := 0; i < num; i++ {
+		profiles = append(profiles, commons.InternalProfiles{
+			UserId: fmt.Sprintf("%s%d", prefix, i),
+			Photos: []commons.InternalPhotos{{ResizedPhotoId: "p", Link: "l", ThumbnailLink: "t"}},
+		})
+	}
+	return profiles
+}
+
+func userIds(profiles []commons.InternalProfiles) []string {
+	result := make([]string, 0, len(profiles))
+	for _, each := range profiles {
+		result = append(result, each.UserId)
+	}
+	return result
+}
+
+func TestCutPage(t *testing.T) {
+	five := &commons.InternalGetLCResp{Profiles: testProfiles("u", 5), AllProfilesNum: 5}
+	tests := []struct {
+		name       string
+		resp       *commons.InternalGetLCResp
+		page       lcPage
+		isItLikes  bool
+		want       []string
+		nextCursor string
+		truncated  bool
+	}{
+		{
+			name:       "first page",
+			resp:       five,
+			page:       lcPage{offset: 0, size: 2},
+			isItLikes:  true,
+			want:       []string{"u0", "u1"},
+			nextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 2, LastUserId: "u1"}),
+		},
+		{
+			name:       "page after the last profile",
+			resp:       five,
+			page:       lcPage{offset: 1, size: 2, lastUserId: "u1"},
+			want:       []string{"u2", "u3"},
+			nextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.MessagesSection, Offset: 4, LastUserId: "u3"}),
+		},
+		{
+			name:       "last profile is not in the section anymore",
+			resp:       five,
+			page:       lcPage{offset: 2, size: 2, lastUserId: "gone"},
+			isItLikes:  true,
+			want:       []string{"u2", "u3"},
+			nextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 4, LastUserId: "u3"}),
+		},
+		{
+			name:      "last page",
+			resp:      five,
+			page:      lcPage{offset: 4, size: 2, lastUserId: "u3"},
+			isItLikes: true,
+			want:      []string{"u4"},
+		},
+		{
+			name:      "after the last page",
+			resp:      five,
+			page:      lcPage{offset: 5, size: 2, lastUserId: "u4"},
+			isItLikes: true,
+			want:      []string{},
+		},
+		{
+			name:       "internal function returned part of the section",
+			resp:       &commons.InternalGetLCResp{Profiles: testProfiles("u", 5), AllProfilesNum: 10},
+			page:       lcPage{offset: 3, size: 2},
+			isItLikes:  true,
+			want:       []string{"u3", "u4"},
+			nextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 5, LastUserId: "u4"}),
+		},
+		{
+			name:      "section is deeper than the limit",
+			resp:      &commons.InternalGetLCResp{Profiles: testProfiles("u", getLcMaxInternalLimit), AllProfilesNum: getLcMaxInternalLimit + 1},
+			page:      lcPage{offset: getLcMaxInternalLimit - 2, size: 2},
+			isItLikes: true,
+			want:      []string{fmt.Sprintf("u%d", getLcMaxInternalLimit-2), fmt.Sprintf("u%d", getLcMaxInternalLimit-1)},
+			truncated: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profiles, nextCursor, truncated := cutPage(test.resp, test.page, test.isItLikes)
+			if !reflect.DeepEqual(userIds(profiles), test.want) {
+				t.Errorf("profiles are %v, want %v", userIds(profiles), test.want)
+			}
+			if nextCursor != test.nextCursor {
+				t.Errorf("next cursor is [%s], want [%s]", nextCursor, test.nextCursor)
+			}
+			if truncated != test.truncated {
+				t.Errorf("truncated is %v, want %v", truncated, test.truncated)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		//of the response
+		statusCode         int
+		likesYou           []string
+		likesYouNextCursor string
+		messages           []string
+		errorField         string
+	}{
+		{
+			name:               "first page",
+			body:               `{"accessToken":"first","resolution":"480x640","lastActionTime":0,"source":"profile","pageSize":2}`,
+			likesYou:           []string{"u0", "u1"},
+			likesYouNextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 2, LastUserId: "u1"}),
+			messages:           []string{"m0"},
+		},
+		{
+			name: "next page",
+			body: fmt.Sprintf(`{"accessToken":"next","resolution":"480x640","lastActionTime":0,"source":"profile","pageSize":2,"likesYouCursor":"%s"}`,
+				apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 2, LastUserId: "u1"})),
+			likesYou:           []string{"u2", "u3"},
+			likesYouNextCursor: apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 4, LastUserId: "u3"}),
+			messages:           []string{"m0"},
+		},
+		{
+			name: "last page",
+			body: fmt.Sprintf(`{"accessToken":"last","resolution":"480x640","lastActionTime":0,"source":"profile","pageSize":2,"likesYouCursor":"%s"}`,
+				apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.LikesYouSection, Offset: 4, LastUserId: "u3"})),
+			likesYou: []string{"u4"},
+			messages: []string{"m0"},
+		},
+		{
+			name: "cursor of another section",
+			body: fmt.Sprintf(`{"accessToken":"wrong","resolution":"480x640","lastActionTime":0,"source":"profile","likesYouCursor":"%s"}`,
+				apimodel.EncodeFeedCursor(apimodel.FeedCursor{Section: apimodel.MessagesSection, Offset: 2})),
+			errorField: "likesYouCursor",
+		},
+		{
+			name:       "without access token",
+			body:       `{"resolution":"480x640","lastActionTime":0,"source":"profile"}`,
+			errorField: "accessToken",
+		},
+		{
+			name:       "get instead of post",
+			method:     "GET",
+			statusCode: commons.NewWrongHttpMethodServiceResponse().StatusCode,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if len(method) == 0 {
+				method = "POST"
+			}
+			resp, err := Handler(context.Background(), events.ALBTargetGroupRequest{HTTPMethod: method, Body: test.body,
+				Headers: map[string]string{"x-ringoid-android-buildnum": "500", "x-forwarded-for": "10.0.0.1"}})
+			if err != nil {
+				t.Fatalf("handler returned error : %v", err)
+			}
+			if test.statusCode != 0 {
+				if resp.StatusCode != test.statusCode {
+					t.Errorf("status code is [%d], want [%d]", resp.StatusCode, test.statusCode)
+				}
+				return
+			}
+			if len(test.errorField) != 0 {
+				var clientError apimodel.ClientError
+				json.Unmarshal([]byte(resp.Body), &clientError)
+				if clientError.Field != test.errorField {
+					t.Errorf("response is %s, want error of [%s]", resp.Body, test.errorField)
+				}
+				return
+			}
+			var feedResp apimodel.GetLcFeedResp
+			if err = json.Unmarshal([]byte(resp.Body), &feedResp); err != nil {
+				t.Fatalf("error unmarshaling response %s : %v", resp.Body, err)
+			}
+			if ids := profileIds(feedResp.LikesYou); !reflect.DeepEqual(ids, test.likesYou) {
+				t.Errorf("likes you are %v, want %v", ids, test.likesYou)
+			}
+			if feedResp.LikesYouNextCursor != test.likesYouNextCursor {
+				t.Errorf("likes you next cursor is [%s], want [%s]", feedResp.LikesYouNextCursor, test.likesYouNextCursor)
+			}
+			if ids := profileIds(feedResp.Messages); !reflect.DeepEqual(ids, test.messages) {
+				t.Errorf("messages are %v, want %v", ids, test.messages)
+			}
+			if len(feedResp.MessagesNextCursor) != 0 {
+				t.Errorf("messages next cursor is [%s], want none", feedResp.MessagesNextCursor)
+			}
+		})
+	}
+}
+
+func profileIds(profiles []commons.Profile) []string {
+	result := make([]string, 0, len(profiles))
+	for _, each := range profiles {
+		result = append(result, each.UserId)
+	}
+	return result
+}
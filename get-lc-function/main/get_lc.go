@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../get-lc-function"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("get-lc-feed")
+}
+
+func main() {
+	basicLambda.Start(getlc.Handler)
+}
@@ -1,27 +1,22 @@
-package main
+package chat
 
 import (
 	"context"
-	basicLambda "github.com/aws/aws-lambda-go/lambda"
 	"../apimodel"
-	"github.com/aws/aws-sdk-go/aws"
-	"encoding/json"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go/service/lambda"
-	"strconv"
 	"github.com/ringoid/commons"
 	"strings"
 )
 
-func init() {
-	apimodel.InitLambdaVars("chat-feed")
-}
-
-func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+func Handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	startTime := commons.UnixTimeInMillis()
 
 	lc, _ := lambdacontext.FromContext(ctx)
+	lc = apimodel.WithRequestId(lc, apimodel.RequestIdFromHeaders(request.Headers))
+
+	ctx, cancel := apimodel.NewRequestContext(ctx)
+	defer cancel()
 
 	userAgent := request.Headers["user-agent"]
 	if strings.HasPrefix(userAgent, "ELB-HealthChecker") {
@@ -31,24 +26,35 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	if request.HTTPMethod != "GET" {
 		return commons.NewWrongHttpMethodServiceResponse(), nil
 	}
+
+	ctx, span := apimodel.StartRequestSpan(ctx, "chat", lc)
+	defer apimodel.DrainCommonsLogs(lc)
+	defer apimodel.FinishRequestSpan(span)
+	defer apimodel.FinishRequestMetrics("chat", startTime)
 	sourceIp := request.Headers["x-forwarded-for"]
+	if ok, errStr := apimodel.Limiter.AllowIp("chat", sourceIp, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "chat.go : return %s to client", errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
 
 	apimodel.Anlogger.Debugf(lc, "chat.go : start handle request %v", request)
 
-	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.Anlogger, lc)
+	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.CommonsLogger, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "chat.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	accessToken, okA := request.QueryStringParameters["accessToken"]
-	resolution, okR := request.QueryStringParameters["resolution"]
-	lastActionTimeStr, okL := request.QueryStringParameters["lastActionTime"]
-	oppositeUserId, okU := request.QueryStringParameters["userId"]
+	params := apimodel.NewParamsValidator(request.QueryStringParameters)
+	accessToken := params.Required("accessToken")
+	resolution := params.Required("resolution")
+	lastActionTimeInt64 := params.RequiredNonNegativeInt64("lastActionTime")
+	oppositeUserId := params.Required("userId")
+	distanceUnit := apimodel.DistanceUnitFromQuery(request.QueryStringParameters, request.Headers, lc)
 
-	if !okA || !okR || !okL || !okU {
-		errStr = commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "chat.go : okA [%v], okR [%v], okL [%v] and okU [%v]", okA, okR, okL, okU)
+	if !params.Ok() {
+		errStr = params.ErrStr()
+		apimodel.Anlogger.Errorf(lc, "chat.go : wrong request params [%s]", params.String())
 		apimodel.Anlogger.Errorf(lc, "chat.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
@@ -58,21 +64,18 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 		resolution = commons.BiggestDefaultPhotoResolution
 	}
 
-	lastActionTimeInt64, err := strconv.ParseInt(lastActionTimeStr, 10, 64)
-	if err != nil || lastActionTimeInt64 < 0 {
-		errStr := commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "chat.go : lastActionTime in wrong format [%s]", lastActionTimeStr)
+	userId, ok, errStr := apimodel.Backend.VerifyAccessToken(ctx, appVersion, isItAndroid, accessToken, lc)
+	if !ok {
 		apimodel.Anlogger.Errorf(lc, "chat.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, accessToken, apimodel.InternalAuthFunctionName, apimodel.ClientLambda, apimodel.Anlogger, lc)
-	if !ok {
-		apimodel.Anlogger.Errorf(lc, "chat.go : return %s to client", errStr)
+	if ok, errStr := apimodel.Limiter.AllowUser("chat", userId, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "chat.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	internalChat, repeatRequestAfter, ok, errStr := getChat(userId, oppositeUserId, lastActionTimeInt64, resolution, lc)
+	internalChat, repeatRequestAfter, ok, errStr := getChat(ctx, userId, oppositeUserId, lastActionTimeInt64, resolution, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "chat.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
@@ -82,60 +85,18 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 
 	feedResp.RepeatRequestAfter = repeatRequestAfter
 	feedResp.IsChatExists = internalChat.IsChatExists
-	photos := make([]commons.Photo, 0)
-	for _, eachPhoto := range internalChat.Profile.Photos {
-		photos = append(photos, commons.Photo{
-			PhotoId:           eachPhoto.ResizedPhotoId,
-			PhotoUri:          commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.Link, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-			ThumbnailPhotoUri: commons.ReplacePhotoUriUsingCloudfrontIfNeeded(eachPhoto.ThumbnailLink, apimodel.CloudFrontDomain, apimodel.Env, apimodel.UseCloudFront),
-		})
-	}
 
-	msgs := make([]commons.Message, 0)
-	for _, eachMsg := range internalChat.Profile.Messages {
-		msgs = append(msgs, eachMsg)
-	}
-
-	lastOnlineText, lastOnlineFlag := apimodel.TransformLastOnlineTimeIntoStatusText(userId, internalChat.Profile.LastOnlineTime, internalChat.Profile.SourceLocale, lc)
-	distanceText := apimodel.TransformDistanceInDistanceText(userId, internalChat.Profile, lc)
-	profile := commons.Profile{
-		UserId:         internalChat.Profile.UserId,
-		Photos:         photos,
-		Messages:       msgs,
-		LastOnlineText: lastOnlineText,
-		LastOnlineFlag: lastOnlineFlag,
-		DistanceText:   distanceText,
-		Age:            internalChat.Profile.Age,
-		Sex:            internalChat.Profile.Sex,
-		Property:       internalChat.Profile.Property,
-		Transport:      internalChat.Profile.Transport,
-		Income:         internalChat.Profile.Income,
-		Height:         internalChat.Profile.Height,
-		EducationLevel: internalChat.Profile.EducationLevel,
-		HairColor:      internalChat.Profile.HairColor,
-		Children:       internalChat.Profile.Children,
-		Name:           internalChat.Profile.Name,
-		JobTitle:       internalChat.Profile.JobTitle,
-		Company:        internalChat.Profile.Company,
-		EducationText:  internalChat.Profile.EducationText,
-		About:          internalChat.Profile.About,
-		Instagram:      internalChat.Profile.Instagram,
-		TikTok:         internalChat.Profile.TikTok,
-		WhereLive:      internalChat.Profile.WhereLive,
-		WhereFrom:      internalChat.Profile.WhereFrom,
-		StatusText:     internalChat.Profile.StatusText,
-		TotalLikes:     internalChat.Profile.TotalLikes,
-	}
-
-	profile = apimodel.CheckProfileBeforeResponse(userId, profile)
+	_, mapSpan := apimodel.StartSpan(ctx, "map profiles")
+	profile := apimodel.MapProfile(userId, internalChat.Profile, apimodel.ProfileMapOptions{IncludeMessages: true, DistanceUnit: distanceUnit, Viewer: apimodel.FlagContext{UserId: userId, AppVersion: appVersion, IsItAndroid: isItAndroid}}, lc)
+	mapSpan.End()
 
 	//todo:delete after all
 	//apimodel.MarkAllMessagesInAChatHaveBeenRead(&feedResp)
 
 	feedResp.ProfileChat = profile
-	feedResp.PullAgainAfter = apimodel.DefaultPoolRepeatTimeSec
+	feedResp.PullAgainAfter = apimodel.Polling.PullAgainAfter(lastMessageAt(profile.Messages), commons.UnixTimeInMillis())
 
-	body, err := json.Marshal(feedResp)
+	body, err := apimodel.MarshalResponse(ctx, feedResp)
 	if err != nil {
 		apimodel.Anlogger.Errorf(lc, "chat.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
 		apimodel.Anlogger.Errorf(lc, "chat.go : userId [%s], return %s to client", userId, commons.InternalServerError)
@@ -143,16 +104,17 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	}
 
 	event := commons.NewChatWasReturnEvent(userId, sourceIp, oppositeUserId, len(feedResp.ProfileChat.Messages), feedResp.RepeatRequestAfter, feedResp.PullAgainAfter)
-	commons.SendAnalyticEvent(event, userId, apimodel.DeliveryStreamName, apimodel.AwsDeliveryStreamClient, apimodel.Anlogger, lc)
-	//commons.SendCloudWatchMetric(apimodel.BaseCloudWatchNamespace, apimodel.NewFaceProfilesReturnMetricName, len(feedResp.Profiles), apimodel.AwsCWClient, apimodel.Anlogger, lc)
+	apimodel.SendAnalyticEvent(event, userId, lc)
 	finishTime := commons.UnixTimeInMillis()
-	apimodel.Anlogger.Infof(lc, "chat.go : successfully return repeat request after [%v], chat to userId [%s] with oppositeUserId [%s], duration [%v]", feedResp.RepeatRequestAfter, userId, feedResp.ProfileChat.UserId, finishTime-startTime)
+	apimodel.Anlogger.WithFields(apimodel.Fields{"endpoint": "chat", "userId": userId, "durationMs": finishTime - startTime,
+		"messages": len(feedResp.ProfileChat.Messages)}).
+		Infof(lc, "chat.go : successfully return repeat request after [%v], chat to userId [%s] with oppositeUserId [%s], duration [%v]", feedResp.RepeatRequestAfter, userId, feedResp.ProfileChat.UserId, finishTime-startTime)
 	//apimodel.Anlogger.Debugf(lc, "chat.go : return successful resp [%s] for userId [%s]", string(body), userId)
 	return commons.NewServiceResponse(string(body)), nil
 }
 
 //response, repeat request after sec, ok and error string
-func getChat(userId, oppositeUserId string, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, int64, bool, string) {
+func getChat(ctx context.Context, userId, oppositeUserId string, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) (commons.InternalChatResponse, int64, bool, string) {
 
 	apimodel.Anlogger.Debugf(lc, "chat.go : get chat userId [%s] and oppositeUserId [%s]", userId, oppositeUserId)
 
@@ -162,40 +124,28 @@ func getChat(userId, oppositeUserId string, lastActionTime int64, resolution str
 		LastActionTime: lastActionTime,
 		Resolution:     resolution,
 	}
-	jsonBody, err := json.Marshal(req)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "chat.go : error marshaling req %s into json for userId [%s] : %v", req, userId, err)
-		return commons.InternalChatResponse{}, 0, false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(apimodel.ChatFunctionName), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "chat.go : error invoke function [%s] with body %s for userId [%s] : %v", apimodel.ChatFunctionName, jsonBody, userId, err)
-		return commons.InternalChatResponse{}, 0, false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "chat.go : status code = %d, response body %s for request %s, for userId [%s] ", *resp.StatusCode, string(resp.Payload), jsonBody, userId)
-		return commons.InternalChatResponse{}, 0, false, commons.InternalServerError
-	}
-
-	var response commons.InternalChatResponse
-	err = json.Unmarshal(resp.Payload, &response)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "chat.go : error unmarshaling response %s into json for userId [%s] : %v", string(resp.Payload), userId, err)
-		return commons.InternalChatResponse{}, 0, false, commons.InternalServerError
+	response, ok, errStr := apimodel.Backend.Chat(ctx, req, lc)
+	if !ok {
+		return commons.InternalChatResponse{}, 0, false, errStr
 	}
 
 	if lastActionTime > response.LastActionTime {
 		apimodel.Anlogger.Debugf(lc, "chat.go : requested lastActionTime [%d] > actual lastActionTime [%d] for userId [%s], diff is [%d]",
 			lastActionTime, response.LastActionTime, userId, response.LastActionTime-lastActionTime)
-		return commons.InternalChatResponse{}, apimodel.DefaultRepeatTimeSec, true, ""
+		return commons.InternalChatResponse{}, apimodel.Polling.RepeatRequestAfter(lastActionTime - response.LastActionTime), true, ""
 	}
 
 	//apimodel.Anlogger.Debugf(lc, "chat.go : successfully got chat for userId [%s] and oppositeUserId [%s], resp %v", userId, oppositeUserId, response)
 	return response, 0, true, ""
 }
 
-func main() {
-	basicLambda.Start(handler)
+//time of the newest message in millis, 0 if there are no messages
+func lastMessageAt(messages []commons.Message) int64 {
+	last := int64(0)
+	for _, each := range messages {
+		if each.MsgAt > last {
+			last = each.MsgAt
+		}
+	}
+	return last
 }
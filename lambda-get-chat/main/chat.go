@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../lambda-get-chat"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("chat-feed")
+}
+
+func main() {
+	basicLambda.Start(chat.Handler)
+}
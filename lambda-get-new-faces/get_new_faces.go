@@ -1,15 +1,10 @@
-package main
+package getnewfaces
 
 import (
 	"context"
-	basicLambda "github.com/aws/aws-lambda-go/lambda"
 	"../apimodel"
-	"github.com/aws/aws-sdk-go/aws"
-	"encoding/json"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go/service/lambda"
-	"strconv"
 	"github.com/ringoid/commons"
 	"strings"
 )
@@ -19,14 +14,14 @@ const (
 	newFacesMaxLimit     = 100
 )
 
-func init() {
-	apimodel.InitLambdaVars("get-new-faces-feed")
-}
-
-func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+func Handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	startTime := commons.UnixTimeInMillis()
 
 	lc, _ := lambdacontext.FromContext(ctx)
+	lc = apimodel.WithRequestId(lc, apimodel.RequestIdFromHeaders(request.Headers))
+
+	ctx, cancel := apimodel.NewRequestContext(ctx)
+	defer cancel()
 
 	userAgent := request.Headers["user-agent"]
 	if strings.HasPrefix(userAgent, "ELB-HealthChecker") {
@@ -36,62 +31,59 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	if request.HTTPMethod != "GET" {
 		return commons.NewWrongHttpMethodServiceResponse(), nil
 	}
+
+	ctx, span := apimodel.StartRequestSpan(ctx, "get_new_faces", lc)
+	defer apimodel.DrainCommonsLogs(lc)
+	defer apimodel.FinishRequestSpan(span)
+	defer apimodel.FinishRequestMetrics("get_new_faces", startTime)
 	sourceIp := request.Headers["x-forwarded-for"]
+	if ok, errStr := apimodel.Limiter.AllowIp("get_new_faces", sourceIp, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
 
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : start handle request %v", request)
 
-	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.Anlogger, lc)
+	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.CommonsLogger, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	accessToken, okA := request.QueryStringParameters["accessToken"]
-	resolution, okR := request.QueryStringParameters["resolution"]
-	lastActionTimeStr, okL := request.QueryStringParameters["lastActionTime"]
+	params := apimodel.NewParamsValidator(request.QueryStringParameters)
+	accessToken := params.Required("accessToken")
+	resolution := params.Required("resolution")
+	lastActionTimeInt64 := params.RequiredNonNegativeInt64("lastActionTime")
+	limit := params.OptionalInt("limit", newFacesDefaultLimit)
+	distanceUnit := apimodel.DistanceUnitFromQuery(request.QueryStringParameters, request.Headers, lc)
 
-	if !okA || !okR || !okL {
-		errStr = commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : okA [%v], okR [%v] and okL [%v]", okA, okR, okL)
+	if !params.Ok() {
+		errStr = params.ErrStr()
+		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : wrong request params [%s]", params.String())
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	limit := newFacesDefaultLimit
-	limitStr := request.QueryStringParameters["limit"]
-	var err error
-	if len(limitStr) != 0 {
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			errStr = commons.WrongRequestParamsClientError
-			apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
-			return commons.NewServiceResponse(errStr), nil
-		}
-	}
-
 	if !commons.AllowedPhotoResolution[resolution] {
 		apimodel.Anlogger.Warnf(lc, "get_new_faces.go : resolution [%s] is not supported, so use [%s] resolution", resolution, commons.BiggestDefaultPhotoResolution)
 		resolution = commons.BiggestDefaultPhotoResolution
 	}
 
-	lastActionTimeInt64, err := strconv.ParseInt(lastActionTimeStr, 10, 64)
-	if err != nil || lastActionTimeInt64 < 0 {
-		errStr := commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : lastActionTime in wrong format [%s]", lastActionTimeStr)
+	userId, ok, errStr := apimodel.Backend.VerifyAccessToken(ctx, appVersion, isItAndroid, accessToken, lc)
+	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, accessToken, apimodel.InternalAuthFunctionName, apimodel.ClientLambda, apimodel.Anlogger, lc)
-	if !ok {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : return %s to client", errStr)
+	if ok, errStr := apimodel.Limiter.AllowUser("get_new_faces", userId, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
 	//!!!WE USE HARDCODED VALUE HERE
 	limit = commons.NewFacesHardcodedLimit
 
-	internalNewFaces, repeatRequestAfter, howMuchPreparedWeNowHave, ok, errStr := getNewFaces(userId, limit, lastActionTimeInt64, resolution, lc)
+	internalNewFaces, repeatRequestAfter, howMuchPreparedWeNowHave, ok, errStr := getNewFaces(ctx, userId, limit, lastActionTimeInt64, resolution, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
@@ -103,60 +95,10 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 		feedResp.RepeatRequestAfter = repeatRequestAfter
 	}
 
-	targetIds := make([]string, 0)
-
-	profiles := make([]commons.Profile, 0)
-	for _, each := range internalNewFaces {
-
-		photos := make([]commons.Photo, 0)
-
-		for _, eachPhoto := range each.Photos {
-			photos = append(photos, commons.Photo{
-				PhotoId:           eachPhoto.ResizedPhotoId,
-				PhotoUri:          eachPhoto.Link,
-				ThumbnailPhotoUri: eachPhoto.ThumbnailLink,
-			})
-		}
-
-		if len(photos) == 0 {
-			apimodel.Anlogger.Warnf(lc, "get_new_faces.go : get new faces return user [%s] with empty photo list for resolution [%s] for userId [%s]",
-				each.UserId, resolution, userId)
-			continue
-		}
-
-		lastOnlineText, lastOnlineFlag := apimodel.TransformLastOnlineTimeIntoStatusText(userId, each.LastOnlineTime, each.SourceLocale, lc)
-		distanceText := apimodel.TransformDistanceInDistanceText(userId, each, lc)
-
-		profile := commons.Profile{
-			UserId:         each.UserId,
-			Photos:         photos,
-			LastOnlineText: lastOnlineText,
-			LastOnlineFlag: lastOnlineFlag,
-			DistanceText:   distanceText,
-			Age:            each.Age,
-			Sex:            each.Sex,
-			Property:       each.Property,
-			Transport:      each.Transport,
-			Income:         each.Income,
-			Height:         each.Height,
-			EducationLevel: each.EducationLevel,
-			HairColor:      each.HairColor,
-			Children:       each.Children,
-			Name:           each.Name,
-			JobTitle:       each.JobTitle,
-			Company:        each.Company,
-			EducationText:  each.EducationText,
-			About:          each.About,
-			Instagram:      each.Instagram,
-			TikTok:         each.TikTok,
-			WhereLive:      each.WhereLive,
-			WhereFrom:      each.WhereFrom,
-		}
-
-		profile = apimodel.CheckProfileBeforeResponse(userId, profile)
-
-		profiles = append(profiles, profile)
+	profiles := apimodel.MapProfiles(ctx, userId, resolution, internalNewFaces, apimodel.ProfileMapOptions{DistanceUnit: distanceUnit, Viewer: apimodel.FlagContext{UserId: userId, AppVersion: appVersion, IsItAndroid: isItAndroid}}, lc)
 
+	targetIds := make([]string, 0)
+	for _, each := range profiles {
 		targetIds = append(targetIds, each.UserId)
 	}
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : prepare [%d] new faces profiles for userId [%s]", len(profiles), userId)
@@ -170,7 +112,7 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 
 	apimodel.MarkNewFacesDefaultSort(userId, &feedResp, lc)
 
-	body, err := json.Marshal(feedResp)
+	body, err := apimodel.MarshalResponse(ctx, feedResp)
 	if err != nil {
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
 		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : userId [%s], return %s to client", userId, commons.InternalServerError)
@@ -179,7 +121,7 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 
 	//now check do we need to make new preparation for new faces
 	if howMuchPreparedWeNowHave < commons.NewFacesHardcodedLimit && repeatRequestAfter == 0 {
-		ok, errStr = prepareNewFacesAsync(userId, lc)
+		ok, errStr = prepareNewFacesAsync(ctx, userId, lc)
 		if !ok {
 			apimodel.Anlogger.Errorf(lc, "get_new_faces.go : userId [%s], return %s to client", userId, errStr)
 			return commons.NewServiceResponse(errStr), nil
@@ -187,16 +129,18 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	}
 
 	event := commons.NewProfileWasReturnToNewFacesEvent(userId, sourceIp, targetIds, feedResp.RepeatRequestAfter)
-	commons.SendAnalyticEvent(event, userId, apimodel.DeliveryStreamName, apimodel.AwsDeliveryStreamClient, apimodel.Anlogger, lc)
-	//commons.SendCloudWatchMetric(apimodel.BaseCloudWatchNamespace, apimodel.NewFaceProfilesReturnMetricName, len(feedResp.Profiles), apimodel.AwsCWClient, apimodel.Anlogger, lc)
+	apimodel.SendAnalyticEvent(event, userId, lc)
+	apimodel.Metrics.ProfilesReturned("get_new_faces", apimodel.NewFacesSection, len(feedResp.Profiles))
 	finishTime := commons.UnixTimeInMillis()
-	apimodel.Anlogger.Infof(lc, "get_new_faces.go : successfully return repeat request after [%v], [%d] new faces profiles to userId [%s], duration [%v]", feedResp.RepeatRequestAfter, len(feedResp.Profiles), userId, finishTime-startTime)
+	apimodel.Anlogger.WithFields(apimodel.Fields{"endpoint": "get_new_faces", "userId": userId, "durationMs": finishTime - startTime,
+		"profiles": len(feedResp.Profiles)}).
+		Infof(lc, "get_new_faces.go : successfully return repeat request after [%v], [%d] new faces profiles to userId [%s], duration [%v]", feedResp.RepeatRequestAfter, len(feedResp.Profiles), userId, finishTime-startTime)
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : return successful resp [%s] for userId [%s]", string(body), userId)
 	return commons.NewServiceResponse(string(body)), nil
 }
 
 //response, repeat request after sec, how much prepared we have now, ok and error string
-func getNewFaces(userId string, limit int, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) ([]commons.InternalProfiles, int64, int64, bool, string) {
+func getNewFaces(ctx context.Context, userId string, limit int, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) ([]commons.InternalProfiles, int64, int64, bool, string) {
 
 	if limit < 0 {
 		limit = newFacesDefaultLimit
@@ -211,34 +155,15 @@ func getNewFaces(userId string, limit int, lastActionTime int64, resolution stri
 		LastActionTime: lastActionTime,
 		Resolution:     resolution,
 	}
-	jsonBody, err := json.Marshal(req)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error marshaling req %s into json for userId [%s] : %v", req, userId, err)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(apimodel.GetNewFacesFunctionName), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error invoke function [%s] with body %s for userId [%s] : %v", apimodel.GetNewFacesFunctionName, jsonBody, userId, err)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : status code = %d, response body %s for request %s, for userId [%s] ", *resp.StatusCode, string(resp.Payload), jsonBody, userId)
-		return nil, 0, 0, false, commons.InternalServerError
-	}
-
-	var response commons.InternalGetNewFacesResp
-	err = json.Unmarshal(resp.Payload, &response)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error unmarshaling response %s into json for userId [%s] : %v", string(resp.Payload), userId, err)
-		return nil, 0, 0, false, commons.InternalServerError
+	response, ok, errStr := apimodel.Backend.GetNewFaces(ctx, req, lc)
+	if !ok {
+		return nil, 0, 0, false, errStr
 	}
 
 	if lastActionTime > response.LastActionTime {
 		apimodel.Anlogger.Debugf(lc, "get_new_faces.go : requested lastActionTime [%d] > actual lastActionTime [%d] for userId [%s], diff is [%d]",
 			lastActionTime, response.LastActionTime, userId, response.LastActionTime-lastActionTime)
-		return nil, apimodel.DefaultRepeatTimeSec, 0, true, ""
+		return nil, apimodel.Polling.RepeatRequestAfter(lastActionTime - response.LastActionTime), 0, true, ""
 	}
 
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : successfully got new faces for userId [%s] with limit [%d], resp %v", userId, limit, response)
@@ -246,32 +171,16 @@ func getNewFaces(userId string, limit int, lastActionTime int64, resolution stri
 }
 
 //ok and error string
-func prepareNewFacesAsync(userId string, lc *lambdacontext.LambdaContext) (bool, string) {
+func prepareNewFacesAsync(ctx context.Context, userId string, lc *lambdacontext.LambdaContext) (bool, string) {
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : send prepare new faces async request for userId [%s]", userId)
 	req := commons.InternalPrepareNewFacesReq{
 		UserId: userId,
 	}
-	jsonBody, err := json.Marshal(req)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error marshaling req %s into json for userId [%s] : %v", req, userId, err)
-		return false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(apimodel.PrepareNewFacesFunctionName), InvocationType: aws.String("Event"), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : error invoke function [%s] with body %s for userId [%s] : %v", apimodel.PrepareNewFacesFunctionName, jsonBody, userId, err)
-		return false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 202 && *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "get_new_faces.go : status code = %d, response body %s for prepare new faces request %s, for userId [%s] ", *resp.StatusCode, string(resp.Payload), jsonBody, userId)
-		return false, commons.InternalServerError
+	ok, errStr := apimodel.Backend.PrepareNewFaces(ctx, req, lc)
+	if !ok {
+		return false, errStr
 	}
 
 	apimodel.Anlogger.Debugf(lc, "get_new_faces.go : successfully send prepare new faces async request for userId [%s]", userId)
 	return true, ""
 }
-
-func main() {
-	basicLambda.Start(handler)
-}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../lambda-get-new-faces"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("get-new-faces-feed")
+}
+
+func main() {
+	basicLambda.Start(getnewfaces.Handler)
+}
@@ -1,102 +1,38 @@
-package main
+package lmhis
 
 import (
 	"context"
-	basicLambda "github.com/aws/aws-lambda-go/lambda"
 	"../apimodel"
-	"github.com/aws/aws-sdk-go/aws"
-	"encoding/json"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/ringoid/commons"
-	"strconv"
 	"sync"
 	"strings"
 )
 
-func init() {
-	apimodel.InitLambdaVars("lmhis-feed")
-}
-
-func handleJob(userId, resolution string, lastActionTimeInt int64, requestNewPart bool, functionName string, innerResult *InnerLmhisResult,
+func handleJob(fanOut *apimodel.FanOut, userId, resolution string, mapOpts apimodel.ProfileMapOptions, lastActionTimeInt int64, requestNewPart bool, functionName string, innerResult *InnerLmhisResult,
 	wg *sync.WaitGroup, lmhisPart string, lc *lambdacontext.LambdaContext) {
 	defer wg.Done()
 
-	llmResult, ok, errStr := lmhis(userId, functionName, lmhisPart, requestNewPart, lastActionTimeInt, resolution, lc)
+	llmResult, ok, errStr := lmhis(fanOut.Context(), userId, functionName, lmhisPart, requestNewPart, lastActionTimeInt, resolution, lc)
 	if !ok {
 		innerResult.ok = ok
 		innerResult.errStr = errStr
+		fanOut.Fail(errStr)
 		return
 	}
 
 	if lastActionTimeInt > llmResult.LastActionTime {
 		innerResult.ok = true
-		innerResult.repeatRequestAfter = apimodel.DefaultRepeatTimeSec
+		innerResult.repeatRequestAfter = apimodel.Polling.RepeatRequestAfter(lastActionTimeInt - llmResult.LastActionTime)
 		apimodel.Anlogger.Debugf(lc, "lmhis.go : (%s) requested lastAction time [%v] > actual last actionTime [%v], diff [%v]",
 			functionName, lastActionTimeInt, llmResult.LastActionTime, llmResult.LastActionTime-lastActionTimeInt)
 		return
 	}
 
-	profiles := make([]commons.Profile, 0)
-	for _, each := range llmResult.Profiles {
-
-		photos := make([]commons.Photo, 0)
-
-		for _, eachPhoto := range each.Photos {
-			photos = append(photos, commons.Photo{
-				PhotoId:           eachPhoto.ResizedPhotoId,
-				PhotoUri:          eachPhoto.Link,
-				ThumbnailPhotoUri: eachPhoto.ThumbnailLink,
-			})
-		}
-
-		messages := make([]commons.Message, 0)
-		for _, eachMessage := range each.Messages {
-			messages = append(messages, eachMessage)
-		}
-
-		if len(photos) == 0 {
-			apimodel.Anlogger.Warnf(lc, "lmhis.go : lmhis return user [%s] with empty photo list for resolution [%s] for userId [%s]",
-				each.UserId, resolution, userId)
-			continue
-		}
-
-		lastOnlineText, lastOnlineFlag := apimodel.TransformLastOnlineTimeIntoStatusText(userId, each.LastOnlineTime, each.SourceLocale, lc)
-		distanceText := apimodel.TransformDistanceInDistanceText(userId, each, lc)
-
-		profile := commons.Profile{
-			UserId:         each.UserId,
-			Photos:         photos,
-			Unseen:         requestNewPart,
-			Messages:       messages,
-			LastOnlineText: lastOnlineText,
-			LastOnlineFlag: lastOnlineFlag,
-			DistanceText:   distanceText,
-			Age:            each.Age,
-			Sex:            each.Sex,
-			Property:       each.Property,
-			Transport:      each.Transport,
-			Income:         each.Income,
-			Height:         each.Height,
-			EducationLevel: each.EducationLevel,
-			HairColor:      each.HairColor,
-			Children:       each.Children,
-			Name:           each.Name,
-			JobTitle:       each.JobTitle,
-			Company:        each.Company,
-			EducationText:  each.EducationText,
-			About:          each.About,
-			Instagram:      each.Instagram,
-			TikTok:         each.TikTok,
-			WhereLive:      each.WhereLive,
-			WhereFrom:      each.WhereFrom,
-		}
-
-		profile = apimodel.CheckProfileBeforeResponse(userId, profile)
-
-		profiles = append(profiles, profile)
-	}
+	mapOpts.Unseen = requestNewPart
+	mapOpts.IncludeMessages = true
+	profiles := apimodel.MapProfiles(fanOut.Context(), userId, resolution, llmResult.Profiles, mapOpts, lc)
 	apimodel.Anlogger.Debugf(lc, "lmhis.go : prepare [%d] likes you profiles for userId [%s]", len(profiles), userId)
 
 	innerResult.ok = true
@@ -106,16 +42,21 @@ func handleJob(userId, resolution string, lastActionTimeInt int64, requestNewPar
 }
 
 type InnerLmhisResult struct {
+	section            string
 	ok                 bool
 	errStr             string
 	repeatRequestAfter int64
 	profiles           []commons.Profile
 }
 
-func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+func Handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	startTime := commons.UnixTimeInMillis()
 
 	lc, _ := lambdacontext.FromContext(ctx)
+	lc = apimodel.WithRequestId(lc, apimodel.RequestIdFromHeaders(request.Headers))
+
+	ctx, cancel := apimodel.NewRequestContext(ctx)
+	defer cancel()
 
 	userAgent := request.Headers["user-agent"]
 	if strings.HasPrefix(userAgent, "ELB-HealthChecker") {
@@ -125,32 +66,36 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	if request.HTTPMethod != "GET" {
 		return commons.NewWrongHttpMethodServiceResponse(), nil
 	}
+
+	ctx, span := apimodel.StartRequestSpan(ctx, "lmhis", lc)
+	defer apimodel.DrainCommonsLogs(lc)
+	defer apimodel.FinishRequestSpan(span)
+	defer apimodel.FinishRequestMetrics("lmhis", startTime)
 	sourceIp := request.Headers["x-forwarded-for"]
+	if ok, errStr := apimodel.Limiter.AllowIp("lmhis", sourceIp, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : return %s to client", errStr)
+		return commons.NewServiceResponse(errStr), nil
+	}
 
 	apimodel.Anlogger.Debugf(lc, "lmhis.go : start handle request %v", request)
 
-	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.Anlogger, lc)
+	appVersion, isItAndroid, ok, errStr := commons.ParseAppVersionFromHeaders(request.Headers, apimodel.CommonsLogger, lc)
 	if !ok {
 		apimodel.Anlogger.Errorf(lc, "lmhis.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	accessToken, okA := request.QueryStringParameters["accessToken"]
-	resolution, okR := request.QueryStringParameters["resolution"]
-	lastActionTimeStr, okL := request.QueryStringParameters["lastActionTime"]
-
-	source, okS := request.QueryStringParameters["source"]
-	if okS {
-		if _, ok := commons.FeedNames[source]; !ok && source != "profile" {
-			errStr = commons.WrongRequestParamsClientError
-			apimodel.Anlogger.Errorf(lc, "lmhis.go : source contains unsupported value [%s]", source)
-			return commons.NewServiceResponse(errStr), nil
-		}
-	}
-
-	if !okA || !okR || !okL {
-		errStr = commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : okA [%v], okR [%v] and okL [%v]", okA, okR, okL)
+	params := apimodel.NewParamsValidator(request.QueryStringParameters)
+	accessToken := params.Required("accessToken")
+	resolution := params.Required("resolution")
+	lastActionTimeInt64 := params.RequiredNonNegativeInt64("lastActionTime")
+	source := params.OptionalSource("source")
+	partialResponse := request.QueryStringParameters[apimodel.PartialResponseParam] == "true"
+	distanceUnit := apimodel.DistanceUnitFromQuery(request.QueryStringParameters, request.Headers, lc)
+
+	if !params.Ok() {
+		errStr = params.ErrStr()
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : wrong request params [%s]", params.String())
 		apimodel.Anlogger.Errorf(lc, "lmhis.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
@@ -160,96 +105,181 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 		resolution = commons.BiggestDefaultPhotoResolution
 	}
 
-	lastActionTimeInt64, err := strconv.ParseInt(lastActionTimeStr, 10, 64)
-	if err != nil || lastActionTimeInt64 < 0 {
-		errStr := commons.WrongRequestParamsClientError
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : lastActionTime in wrong format [%s]", lastActionTimeStr)
+	userId, ok, errStr := apimodel.Backend.VerifyAccessToken(ctx, appVersion, isItAndroid, accessToken, lc)
+	if !ok {
 		apimodel.Anlogger.Errorf(lc, "lmhis.go : return %s to client", errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
-	userId, ok, _, errStr := commons.CallVerifyAccessToken(appVersion, isItAndroid, accessToken, apimodel.InternalAuthFunctionName, apimodel.ClientLambda, apimodel.Anlogger, lc)
-	if !ok {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : return %s to client", errStr)
+	if ok, errStr := apimodel.Limiter.AllowUser("lmhis", userId, lc); !ok {
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : userId [%s], return %s to client", userId, errStr)
 		return commons.NewServiceResponse(errStr), nil
 	}
 
+	mapOpts := apimodel.ProfileMapOptions{
+		DistanceUnit: distanceUnit,
+		Viewer:       apimodel.FlagContext{UserId: userId, AppVersion: appVersion, IsItAndroid: isItAndroid},
+	}
+
+	key := apimodel.CoalesceKey{Endpoint: "lmhis", UserId: userId, LastActionTime: lastActionTimeInt64, Resolution: resolution,
+		Filter: apimodel.CoalesceFilter(partialResponse, distanceUnit, appVersion, isItAndroid)}
+	result, ok, errStr, fresh := apimodel.Coalescing.Do(ctx, key, func(ctx context.Context) (interface{}, bool, string) {
+		return buildFeed(ctx, userId, resolution, mapOpts, lastActionTimeInt64, partialResponse, lc)
+	}, lc)
+	if !ok {
+		//degraded mode, the last good feed is better than an error
+		staleResp := &apimodel.LMHISFeedResp{}
+		if !apimodel.IsBackendError(errStr) || !apimodel.Fallback.Recall(key, staleResp, lc) {
+			return commons.NewServiceResponse(errStr), nil
+		}
+		apimodel.Anlogger.Warnf(lc, "lmhis.go : internal functions failed with %s, return the last good feed to userId [%s]", errStr, userId)
+		result, fresh = staleResp, false
+	}
+	feedResp := result.(*apimodel.LMHISFeedResp)
+	complete := fresh && feedResp.RepeatRequestAfter == 0 && !feedResp.SectionStatus.AnyFailed()
+	if complete {
+		apimodel.Coalescing.Remember(key, feedResp)
+	}
+
+	body, err := apimodel.MarshalResponse(ctx, feedResp)
+	if err != nil {
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : userId [%s], return %s to client", userId, commons.InternalServerError)
+		return commons.NewServiceResponse(commons.InternalServerError), nil
+	}
+	if complete {
+		apimodel.Fallback.Remember(key, body, lc)
+	}
+
+	event := commons.NewProfileWasReturnToLMHISEvent(userId, sourceIp, source, len(feedResp.LikesYou), len(feedResp.Matches), len(feedResp.Hellos), len(feedResp.Inbox), len(feedResp.Sent), feedResp.RepeatRequestAfter)
+	apimodel.SendAnalyticEvent(event, userId, lc)
+
+	apimodel.Metrics.ProfilesReturned("lmhis", apimodel.LikesYouSection, len(feedResp.LikesYou))
+	apimodel.Metrics.ProfilesReturned("lmhis", apimodel.MatchesSection, len(feedResp.Matches))
+	apimodel.Metrics.ProfilesReturned("lmhis", apimodel.HellosSection, len(feedResp.Hellos))
+	apimodel.Metrics.ProfilesReturned("lmhis", apimodel.InboxSection, len(feedResp.Inbox))
+	apimodel.Metrics.ProfilesReturned("lmhis", apimodel.SentSection, len(feedResp.Sent))
+
+	finishTime := commons.UnixTimeInMillis()
+	apimodel.Anlogger.WithFields(apimodel.Fields{"endpoint": "lmhis", "userId": userId, "durationMs": finishTime - startTime,
+		"likesYou": len(feedResp.LikesYou), "matches": len(feedResp.Matches), "hellos": len(feedResp.Hellos), "inbox": len(feedResp.Inbox), "sent": len(feedResp.Sent)}).
+		Infof(lc, "lmhis.go : successfully return repeat request after [%v], [%d] likes you profiles, [%d] matches, [%d] hellos, [%d] inbox and [%d] sent to userId [%s], duration [%v]",
+			feedResp.RepeatRequestAfter, len(feedResp.LikesYou), len(feedResp.Matches), len(feedResp.Hellos), len(feedResp.Inbox), len(feedResp.Sent), userId, finishTime-startTime)
+	apimodel.Anlogger.Debugf(lc, "lmhis.go : return successful resp [%s] for userId [%s]", string(body), userId)
+	return commons.NewServiceResponse(string(body)), nil
+}
+
+//buildFeed fans out to internal functions and builds the response, ok and error string
+func buildFeed(ctx context.Context, userId, resolution string, mapOpts apimodel.ProfileMapOptions, lastActionTimeInt64 int64, partialResponse bool,
+	lc *lambdacontext.LambdaContext) (*apimodel.LMHISFeedResp, bool, string) {
 	//prepare response
-	feedResp := apimodel.LMHISFeedResp{}
+	feedResp := &apimodel.LMHISFeedResp{}
 	feedResp.LikesYou = make([]commons.Profile, 0)
 	feedResp.Matches = make([]commons.Profile, 0)
 	feedResp.Hellos = make([]commons.Profile, 0)
 	feedResp.Inbox = make([]commons.Profile, 0)
 	feedResp.Sent = make([]commons.Profile, 0)
 
+	//in partial response mode other sections are still useful after one fails
+	fanOut := apimodel.NewFanOut(ctx, !partialResponse)
+	defer fanOut.Cancel()
+
 	var commonWaitGroup sync.WaitGroup
 
 	//likes you (new part)
 	commonWaitGroup.Add(1)
-	likesYouNewPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, true, apimodel.LikesYouFunctionName, &likesYouNewPart,
+	likesYouNewPart := InnerLmhisResult{section: apimodel.LikesYouSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, true, apimodel.Settings().LikesYouFunctionName, &likesYouNewPart,
 		&commonWaitGroup, "unknown part", lc)
 
 	//likes you (old part)
 	commonWaitGroup.Add(1)
-	likesYouOldPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, false, apimodel.LikesYouFunctionName, &likesYouOldPart,
+	likesYouOldPart := InnerLmhisResult{section: apimodel.LikesYouSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, false, apimodel.Settings().LikesYouFunctionName, &likesYouOldPart,
 		&commonWaitGroup, "unknown part", lc)
 
 	//matches (new part)
 	commonWaitGroup.Add(1)
-	matchesNewPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, true, apimodel.MatchesFunctionName, &matchesNewPart,
+	matchesNewPart := InnerLmhisResult{section: apimodel.MatchesSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, true, apimodel.Settings().MatchesFunctionName, &matchesNewPart,
 		&commonWaitGroup, "unknown part", lc)
 
 	//matches (old part)
 	commonWaitGroup.Add(1)
-	matchesOldPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, false, apimodel.MatchesFunctionName, &matchesOldPart,
+	matchesOldPart := InnerLmhisResult{section: apimodel.MatchesSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, false, apimodel.Settings().MatchesFunctionName, &matchesOldPart,
 		&commonWaitGroup, "unknown part", lc)
 
 	//hellos (new part)
 	commonWaitGroup.Add(1)
-	hellosNewPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, true, apimodel.LMHISFunctionName, &hellosNewPart,
+	hellosNewPart := InnerLmhisResult{section: apimodel.HellosSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, true, apimodel.Settings().LMHISFunctionName, &hellosNewPart,
 		&commonWaitGroup, "hellos", lc)
 
 	//hellos (old part)
 	commonWaitGroup.Add(1)
-	hellosOldPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, false, apimodel.LMHISFunctionName, &hellosOldPart,
+	hellosOldPart := InnerLmhisResult{section: apimodel.HellosSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, false, apimodel.Settings().LMHISFunctionName, &hellosOldPart,
 		&commonWaitGroup, "hellos", lc)
 
 	//inbox
 	commonWaitGroup.Add(1)
-	inboxPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, false, apimodel.LMHISFunctionName, &inboxPart,
+	inboxPart := InnerLmhisResult{section: apimodel.InboxSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, false, apimodel.Settings().LMHISFunctionName, &inboxPart,
 		&commonWaitGroup, "inbox", lc)
 
 	//sent
 	commonWaitGroup.Add(1)
-	sentPart := InnerLmhisResult{}
-	go handleJob(userId, resolution, lastActionTimeInt64, false, apimodel.LMHISFunctionName, &sentPart,
+	sentPart := InnerLmhisResult{section: apimodel.SentSection}
+	go handleJob(fanOut, userId, resolution, mapOpts, lastActionTimeInt64, false, apimodel.Settings().LMHISFunctionName, &sentPart,
 		&commonWaitGroup, "sent", lc)
 
 	commonWaitGroup.Wait()
 
-	if !likesYouNewPart.ok || !likesYouOldPart.ok ||
-		!matchesNewPart.ok || !matchesOldPart.ok ||
-		!hellosNewPart.ok || !hellosOldPart.ok ||
-		!inboxPart.ok ||
-		!sentPart.ok {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : userId [%s], return %s to client", userId, likesYouNewPart.errStr)
-		return commons.NewServiceResponse(likesYouNewPart.errStr), nil
+	parts := []*InnerLmhisResult{&likesYouNewPart, &likesYouOldPart, &matchesNewPart, &matchesOldPart,
+		&hellosNewPart, &hellosOldPart, &inboxPart, &sentPart}
+
+	if errStr := fanOut.ErrStr(); len(errStr) != 0 && !partialResponse {
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : userId [%s], return %s to client", userId, errStr)
+		return nil, false, errStr
+	}
+
+	errStr := ""
+	sectionStatus := apimodel.SectionStatus{}
+	for _, each := range parts {
+		if each.ok {
+			sectionStatus.MarkOk(each.section)
+			continue
+		}
+		apimodel.Anlogger.Warnf(lc, "lmhis.go : section [%s] failed with %s for userId [%s]", each.section, each.errStr, userId)
+		sectionStatus.MarkFailed(each.section)
+		errStr = each.errStr
+	}
+
+	if sectionStatus.AllFailed() {
+		apimodel.Anlogger.Errorf(lc, "lmhis.go : all sections failed, userId [%s], return %s to client", userId, errStr)
+		return nil, false, errStr
 	}
 
-	if likesYouNewPart.repeatRequestAfter != 0 || likesYouOldPart.repeatRequestAfter != 0 ||
-		matchesNewPart.repeatRequestAfter != 0 || matchesOldPart.repeatRequestAfter != 0 ||
-		hellosNewPart.repeatRequestAfter != 0 || hellosOldPart.repeatRequestAfter != 0 ||
-		inboxPart.repeatRequestAfter != 0 ||
-		sentPart.repeatRequestAfter != 0 {
-		apimodel.Anlogger.Debugf(lc, "lmhis.go : return repeat request after [%v] for userId [%s]", apimodel.DefaultRepeatTimeSec, userId)
-		feedResp.RepeatRequestAfter = apimodel.DefaultRepeatTimeSec
+	repeatRequestAfter := int64(0)
+	for _, each := range parts {
+		if !sectionStatus.IsOk(each.section) {
+			//do not return a half of failed section
+			each.profiles = nil
+		}
+		//the most lagging part defines when to repeat
+		if each.repeatRequestAfter > repeatRequestAfter {
+			repeatRequestAfter = each.repeatRequestAfter
+		}
+	}
+
+	if partialResponse {
+		feedResp.SectionStatus = sectionStatus
+	}
+
+	if repeatRequestAfter != 0 {
+		apimodel.Anlogger.Debugf(lc, "lmhis.go : return repeat request after [%v] for userId [%s]", repeatRequestAfter, userId)
+		feedResp.RepeatRequestAfter = repeatRequestAfter
 	} else {
 		feedResp.LikesYou = append(feedResp.LikesYou, likesYouNewPart.profiles...)
 		feedResp.LikesYou = append(feedResp.LikesYou, likesYouOldPart.profiles...)
@@ -266,26 +296,11 @@ func handler(ctx context.Context, request events.ALBTargetGroupRequest) (events.
 	}
 
 	//mark sorting
-	apimodel.MarkLMHISDefaultSort(userId, &feedResp, lc)
-
-	body, err := json.Marshal(feedResp)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : error while marshaling resp [%v] object for userId [%s] : %v", feedResp, userId, err)
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : userId [%s], return %s to client", userId, commons.InternalServerError)
-		return commons.NewServiceResponse(commons.InternalServerError), nil
-	}
-
-	event := commons.NewProfileWasReturnToLMHISEvent(userId, sourceIp, source, len(feedResp.LikesYou), len(feedResp.Matches), len(feedResp.Hellos), len(feedResp.Inbox), len(feedResp.Sent), feedResp.RepeatRequestAfter)
-	commons.SendAnalyticEvent(event, userId, apimodel.DeliveryStreamName, apimodel.AwsDeliveryStreamClient, apimodel.Anlogger, lc)
-
-	finishTime := commons.UnixTimeInMillis()
-	apimodel.Anlogger.Infof(lc, "lmhis.go : successfully return repeat request after [%v], [%d] likes you profiles, [%d] matches, [%d] hellos, [%d] inbox and [%d] sent to userId [%s], duration [%v]",
-		feedResp.RepeatRequestAfter, len(feedResp.LikesYou), len(feedResp.Matches), len(feedResp.Hellos), len(feedResp.Inbox), len(feedResp.Sent), userId, finishTime-startTime)
-	apimodel.Anlogger.Debugf(lc, "lmhis.go : return successful resp [%s] for userId [%s]", string(body), userId)
-	return commons.NewServiceResponse(string(body)), nil
+	apimodel.MarkLMHISDefaultSort(userId, feedResp, lc)
+	return feedResp, true, ""
 }
 
-func lmhis(userId, functionName, lmhisPart string, requestNewPart bool, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
+func lmhis(ctx context.Context, userId, functionName, lmhisPart string, requestNewPart bool, lastActionTime int64, resolution string, lc *lambdacontext.LambdaContext) (commons.InternalLMHISResp, bool, string) {
 
 	apimodel.Anlogger.Debugf(lc, "lmhis.go : get lmhis (function name %s, lmhisPart %s, request new part %v) you for userId [%s]",
 		functionName, lmhisPart, requestNewPart, userId)
@@ -297,39 +312,12 @@ func lmhis(userId, functionName, lmhisPart string, requestNewPart bool, lastActi
 		Resolution:              resolution,
 		LMHISPart:               lmhisPart,
 	}
-	jsonBody, err := json.Marshal(req)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : error marshaling req %s into json for userId [%s] (function name %s,  lmhisPart %s, request new part %v) : %v",
-			req, userId, functionName, lmhisPart, requestNewPart, err)
-		return commons.InternalLMHISResp{}, false, commons.InternalServerError
-	}
-
-	resp, err := apimodel.ClientLambda.Invoke(&lambda.InvokeInput{FunctionName: aws.String(functionName), Payload: jsonBody})
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : error invoke function [%s] with body %s for userId [%s] (request new part %v) : %v",
-			functionName, jsonBody, userId, requestNewPart, err)
-		return commons.InternalLMHISResp{}, false, commons.InternalServerError
-	}
-
-	if *resp.StatusCode != 200 {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : status code = %d, response body %s for request %s, for userId [%s] (function name %s, lmhisPart %s, request new part %v)",
-			*resp.StatusCode, string(resp.Payload), jsonBody, userId, functionName, lmhisPart, requestNewPart)
-		return commons.InternalLMHISResp{}, false, commons.InternalServerError
-	}
-
-	var response commons.InternalLMHISResp
-	err = json.Unmarshal(resp.Payload, &response)
-	if err != nil {
-		apimodel.Anlogger.Errorf(lc, "lmhis.go : error unmarshaling response %s into json for userId [%s] (function name %s, lmhisPart %s, request new part %v) : %v",
-			string(resp.Payload), userId, functionName, lmhisPart, requestNewPart, err)
-		return commons.InternalLMHISResp{}, false, commons.InternalServerError
+	response, ok, errStr := apimodel.Backend.LMHIS(ctx, functionName, req, lc)
+	if !ok {
+		return commons.InternalLMHISResp{}, false, errStr
 	}
 
 	apimodel.Anlogger.Debugf(lc, "lmhis.go : successfully got profiles for userId [%s] (function name %s, lmhisPart %s, request new part %v), resp %v",
 		userId, functionName, lmhisPart, requestNewPart, response)
 	return response, true, ""
 }
-
-func main() {
-	basicLambda.Start(handler)
-}
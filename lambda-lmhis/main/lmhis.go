@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../lambda-lmhis"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("lmhis-feed")
+}
+
+func main() {
+	basicLambda.Start(lmhis.Handler)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"../../apimodel"
+	"../../lambda-lmm"
+	basicLambda "github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	apimodel.InitLambdaVars("lmm-feed")
+}
+
+func main() {
+	basicLambda.Start(lmm.Handler)
+}
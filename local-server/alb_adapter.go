@@ -0,0 +1,87 @@
+package main
+
+import (
+	"../apimodel"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type ALBHandler func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error)
+
+//NewLocalHttpHandler serves lambda handlers by path the same way ALB target groups do
+func NewLocalHttpHandler(routes map[string]ALBHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			apimodel.Anlogger.Errorf(nil, "alb_adapter.go : error reading body of request to [%s] : %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := handler(r.Context(), toALBRequest(r, string(body)))
+		if err != nil {
+			apimodel.Anlogger.Errorf(nil, "alb_adapter.go : handler of [%s] return error : %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		for key, value := range resp.Headers {
+			w.Header().Set(key, value)
+		}
+		statusCode := resp.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		w.WriteHeader(statusCode)
+		w.Write([]byte(resp.Body))
+	})
+}
+
+func toALBRequest(r *http.Request, body string) events.ALBTargetGroupRequest {
+	//ALB lowercases header names and keeps the last value
+	headers := make(map[string]string)
+	for key, values := range r.Header {
+		headers[strings.ToLower(key)] = values[len(values)-1]
+	}
+	if _, ok := headers["x-forwarded-for"]; !ok {
+		//RemoteAddr is host:port, host of ipv6 address is in brackets
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		headers["x-forwarded-for"] = host
+	}
+
+	//ALB does not decode query string parameters
+	query := make(map[string]string)
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		if len(pair) == 0 {
+			continue
+		}
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) == 2 {
+			query[keyValue[0]] = keyValue[1]
+		} else {
+			query[keyValue[0]] = ""
+		}
+	}
+
+	return events.ALBTargetGroupRequest{
+		HTTPMethod:            r.Method,
+		Path:                  r.URL.Path,
+		QueryStringParameters: query,
+		Headers:               headers,
+		Body:                  body,
+		IsBase64Encoded:       false,
+	}
+}
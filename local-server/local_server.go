@@ -0,0 +1,49 @@
+package main
+
+import (
+	"../apimodel"
+	"../lambda-get-new-faces"
+	"../lambda-lmm"
+	"../lambda-lmhis"
+	"../lambda-get-chat"
+	"../discover-function"
+	"../get-lc-function"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	stubFile := flag.String("stub", "", "json file with canned internal function responses")
+	flag.Parse()
+
+	backend := apimodel.NewFakeFeedsBackend()
+	if len(*stubFile) != 0 {
+		var err error
+		backend, err = apimodel.LoadFakeFeedsBackend(*stubFile)
+		if err != nil {
+			fmt.Printf("local_server.go : error loading stub file [%s] : %v\n", *stubFile, err)
+			os.Exit(1)
+		}
+	}
+
+	apimodel.InitLocalVars("local-feeds", backend)
+
+	routes := map[string]ALBHandler{
+		"/feeds/get_new_faces": getnewfaces.Handler,
+		"/feeds/get_lmm":       lmm.Handler,
+		"/feeds/get_lmhis":     lmhis.Handler,
+		"/feeds/chat":          chat.Handler,
+		"/feeds/discover":      discover.Handler,
+		"/feeds/get_lc":        getlc.Handler,
+	}
+
+	fmt.Printf("local_server.go : serve feeds on [%s]\n", *addr)
+	err := http.ListenAndServe(*addr, NewLocalHttpHandler(routes))
+	if err != nil {
+		fmt.Printf("local_server.go : error serving feeds : %v\n", err)
+		os.Exit(1)
+	}
+}